@@ -0,0 +1,103 @@
+package main
+
+import (
+    "archive/tar"
+    "archive/zip"
+    "bufio"
+    "bytes"
+    "io"
+    "io/ioutil"
+    "path"
+    "strings"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// Searching members of tar and zip archives
+//
+// Each regular file in an archive is searched as if it were given on the
+// command line, labeled as 'ARCHIVE:MEMBER'. --include, --exclude and
+// --exclude-dir are applied to member paths.
+
+var magicZip = []byte("PK\x03\x04")
+
+// isTar checks "ustar" magic in the header of the first member
+func isTar(r *bufio.Reader) bool {
+    head, _ := r.Peek(262)
+    return len(head) == 262 && bytes.Equal(head[257:262], []byte("ustar"))
+}
+
+func isZip(r *bufio.Reader) bool {
+    head, _ := r.Peek(len(magicZip))
+    return bytes.Equal(head, magicZip)
+}
+
+// globs are matched against both full path and base name of a member
+func includeMember(p string) bool {
+    dir, base := path.Split(p)
+    for _, d := range strings.Split(strings.Trim(dir, "/"), "/") {
+        if matchAny(*optExcludeDir, d) {
+            return false
+        }
+    }
+    if len(*optInclude) > 0 && !matchAny(*optInclude, p) && !matchAny(*optInclude, base) {
+        return false
+    }
+    return !matchAny(*optExclude, p) && !matchAny(*optExclude, base)
+}
+
+func grepMember(pat string, rs string, label string, r io.Reader, merge chan<- Merged) {
+    // archives contain multiple files; always tell which one matched.
+    // Already set with --merge, where files are searched concurrently.
+    if !withFilename {
+        withFilename = true
+    }
+    grepStream(pat, rs, label, r, true, *optBinaryFiles == "skip", Position{}, merge)
+}
+
+func grepTar(pat string, rs string, name string, r io.Reader, merge chan<- Merged) {
+    tr := tar.NewReader(r)
+    for {
+        hdr, err := tr.Next()
+        if err == io.EOF {
+            return
+        }
+        if err != nil {
+            warn("%s: %s", name, err)
+            return
+        }
+        if hdr.Typeflag != tar.TypeReg || !includeMember(hdr.Name) {
+            continue
+        }
+        grepMember(pat, rs, name + ":" + hdr.Name, tr, merge)
+    }
+}
+
+func grepZip(pat string, rs string, name string, r io.ReaderAt, size int64, merge chan<- Merged) {
+    zr, err := zip.NewReader(r, size)
+    if err != nil {
+        warn("%s: %s", name, err)
+        return
+    }
+    for _, f := range zr.File {
+        if f.FileInfo().IsDir() || !includeMember(f.Name) {
+            continue
+        }
+        rc, err := f.Open()
+        if err != nil {
+            warn("%s:%s: %s", name, f.Name, err)
+            continue
+        }
+        grepMember(pat, rs, name + ":" + f.Name, rc, merge)
+        rc.Close()
+    }
+}
+
+// zip needs random access; used when the archive is not a plain file
+func grepZipStream(pat string, rs string, name string, r io.Reader, merge chan<- Merged) {
+    data, err := ioutil.ReadAll(r)
+    if err != nil {
+        warn("%s: %s", name, err)
+        return
+    }
+    grepZip(pat, rs, name, bytes.NewReader(data), int64(len(data)), merge)
+}
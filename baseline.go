@@ -0,0 +1,139 @@
+package main
+
+import (
+    "bufio"
+    "encoding/binary"
+    "fmt"
+    "hash/fnv"
+    "io"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// New record detection against a baseline (--baseline)
+//
+// Records of baseline files, split with the same RS, are normalized as
+// with --uniq and remembered by their fingerprints (64-bit FNV-1a hash).
+// Records whose fingerprint is in the baseline are not selected. The set
+// can be saved with --save-baseline and given to --baseline instead of the
+// log files next time.
+
+// header of a saved fingerprint set, followed by --normalize list
+const BASELINE_MAGIC = "gmlgrep-baseline 1 "
+
+type Baseline struct {
+    norm *Normalizer
+    set  map[uint64]bool
+}
+
+// set in main() with --baseline
+var baseline *Baseline
+
+func NewBaseline(norm *Normalizer) *Baseline {
+    return &Baseline{norm: norm, set: make(map[uint64]bool)}
+}
+
+func (b *Baseline) fingerprint(text string) uint64 {
+    h := fnv.New64a()
+    io.WriteString(h, b.norm.normalize(text))
+    return h.Sum64()
+}
+
+// known reports whether a record of the same shape is in the baseline
+func (b *Baseline) known(text string) bool {
+    return b.set[b.fingerprint(text)]
+}
+
+// forEachRecord calls fn for each record in r, with RS at its beginning
+// as grep_record() sees it.
+func forEachRecord(rs string, r io.Reader, fn func(text string)) error {
+    splitter := NewSplitRecordFirstFinder("", rs)
+    scanner := bufio.NewScanner(r)
+    if *optNullData {
+        scanner.Split(splitter.SplitNull)
+    } else {
+        scanner.Split(splitter.Split)
+    }
+    var joiner RecordJoiner
+    for scanner.Scan() {
+        rec := Record{scanner.Text(), splitter.rsPos, splitter.rsSize}
+        if text, _ := joiner.join(rec); text != "" {
+            fn(text)
+        }
+    }
+    if text, _ := joiner.last(); text != "" {
+        fn(text)
+    }
+    return scanner.Err()
+}
+
+// load adds records of a log file, or a saved fingerprint set, to b
+func (b *Baseline) load(name string, rs string) {
+    file, err := os.Open(name)
+    checkError(err)
+    defer file.Close()
+    r, err := decompress(file)
+    checkError(err)
+    defer r.Close()
+    br := bufio.NewReader(r)
+    if magic, _ := br.Peek(len(BASELINE_MAGIC)); string(magic) == BASELINE_MAGIC {
+        b.loadSaved(name, br)
+        return
+    }
+    err = forEachRecord(rs, br, func(text string) {
+        b.set[b.fingerprint(text)] = true
+    })
+    if err != nil {
+        checkError(fmt.Errorf("%s: %s", name, err))
+    }
+    debug("baseline: %d fingerprints after %s\n", len(b.set), name)
+}
+
+func (b *Baseline) loadSaved(name string, r *bufio.Reader) {
+    header, err := r.ReadString('\n')
+    checkError(err)
+    if normalize := strings.TrimSpace(header[len(BASELINE_MAGIC):]); normalize != *optNormalize {
+        warn("%s: saved with --normalize=%s", name, normalize)
+    }
+    var fp [8]byte
+    for {
+        if _, err := io.ReadFull(r, fp[:]); err != nil {
+            if err != io.EOF {
+                checkError(fmt.Errorf("%s: %s", name, err))
+            }
+            return
+        }
+        b.set[binary.LittleEndian.Uint64(fp[:])] = true
+    }
+}
+
+// save writes the fingerprint set to path, in ascending order so that
+// the same set makes the same file.
+func (b *Baseline) save(path string) {
+    fps := make([]uint64, 0, len(b.set))
+    for fp := range b.set {
+        fps = append(fps, fp)
+    }
+    sort.Slice(fps, func(i, j int) bool { return fps[i] < fps[j] })
+    data := []byte(BASELINE_MAGIC + *optNormalize + "\n")
+    for _, fp := range fps {
+        data = binary.LittleEndian.AppendUint64(data, fp)
+    }
+    tmp, err := ioutil.TempFile(filepath.Dir(path), ".gmlgrep-baseline")
+    checkError(err)
+    _, err = tmp.Write(data)
+    if err == nil {
+        err = tmp.Close()
+    }
+    if err == nil {
+        err = os.Rename(tmp.Name(), path)
+    }
+    if err != nil {
+        os.Remove(tmp.Name())
+    }
+    checkError(err)
+}
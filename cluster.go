@@ -0,0 +1,122 @@
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "io"
+    "sort"
+    "strings"
+    "sync"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// Clustering records into templates (--cluster)
+//
+// An online algorithm after Drain (He et al., ICWS 2017). A record is
+// normalized as with --uniq and split into whitespace separated tokens,
+// and joins the most similar cluster of records with the same number of
+// tokens and the same first token, if it is similar enough; tokens that
+// differ within a cluster become '<*>' in its template. Multi-line records
+// are treated as a single sequence of tokens.
+
+const CLUSTER_WILDCARD = "<*>"
+
+type cluster struct {
+    template []string
+    count    int
+    example  Seen
+}
+
+// similarity is ratio of tokens same as the template, not counting '<*>'
+func (c *cluster) similarity(tokens []string) float64 {
+    same := 0
+    for i, t := range c.template {
+        if t == tokens[i] && t != CLUSTER_WILDCARD {
+            same++
+        }
+    }
+    return float64(same) / float64(len(tokens))
+}
+
+func (c *cluster) merge(tokens []string) {
+    for i, t := range c.template {
+        if t != tokens[i] {
+            c.template[i] = CLUSTER_WILDCARD
+        }
+    }
+    c.count++
+}
+
+type Clusters struct {
+    norm       *Normalizer
+    similarity float64
+    lock       sync.Mutex
+    groups     map[string][]*cluster // by number of tokens and first token
+    clusters   []*cluster
+}
+
+func NewClusters(norm *Normalizer, similarity float64) *Clusters {
+    return &Clusters{norm: norm, similarity: similarity, groups: make(map[string][]*cluster)}
+}
+
+func (cs *Clusters) add(name string, e Entry) {
+    tokens := strings.Fields(cs.norm.normalize(e.text))
+    if len(tokens) == 0 {
+        return
+    }
+    first := tokens[0]
+    if strings.ContainsAny(first, "0123456789") {
+        first = CLUSTER_WILDCARD // likely a variable
+    }
+    key := fmt.Sprintf("%d %s", len(tokens), first)
+
+    cs.lock.Lock()
+    defer cs.lock.Unlock()
+    var best *cluster
+    bestSim := -1.0
+    for _, c := range cs.groups[key] {
+        if sim := c.similarity(tokens); sim > bestSim {
+            best, bestSim = c, sim
+        }
+    }
+    if best != nil && bestSim >= cs.similarity {
+        best.merge(tokens)
+        return
+    }
+    c := &cluster{template: tokens, count: 1, example: Seen{name, e}}
+    cs.groups[key] = append(cs.groups[key], c)
+    cs.clusters = append(cs.clusters, c)
+}
+
+type jsonCluster struct {
+    Count    int      `json:"count"`
+    Template string   `json:"template"`
+    Example  jsonSeen `json:"example"`
+    Record   string   `json:"record"`
+}
+
+// print shows a table of templates, most frequent first, with the first
+// line of an example record and where it was found.
+func (cs *Clusters) print(w *bufio.Writer) {
+    sort.SliceStable(cs.clusters, func(i, j int) bool {
+        return cs.clusters[i].count > cs.clusters[j].count
+    })
+    for _, c := range cs.clusters {
+        template := strings.Join(c.template, " ")
+        ex := c.example
+        if *optOutput == "jsonl" {
+            b, err := json.Marshal(jsonCluster{c.count, template, ex.json(), ex.e.text})
+            checkError(err)
+            w.Write(append(b, '\n'))
+            continue
+        }
+        line := strings.TrimLeft(ex.e.text, "\n")
+        if eol := strings.IndexByte(line, '\n'); eol >= 0 {
+            line = line[:eol]
+        }
+        io.WriteString(w, fmt.Sprintf("%8d  %s\n", c.count, template))
+        io.WriteString(w, fmt.Sprintf("%8s  e.g. %s: %s\n", "", ex, line))
+    }
+    w.Flush()
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+    "bufio"
+    "io"
+    "time"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// Record-based context (-A, -B and -C) and time-based context
+// (--after-time, --before-time and --context-time)
+//
+// Unlike grep(1), context is counted in records, not lines, or given as
+// a time window around timestamp of matching records. Groups of printed
+// records which are not adjacent in the input are separated by
+// GROUP_SEPARATOR, which is terminated by NUL, instead of newline, with
+// --null like other records.
+
+const GROUP_SEPARATOR = "--"
+
+// -A and -B take precedence over -C, like grep(1); negative if not given
+func contextSize(n int) int {
+    if n < 0 {
+        return *optContext
+    }
+    return n
+}
+
+// same for --after-time and --before-time over --context-time
+func contextTime(s string) time.Duration {
+    if s == "" {
+        s = *optContextTime
+    }
+    if s == "" {
+        return 0
+    }
+    d, err := time.ParseDuration(s)
+    checkError(err)
+    return d
+}
+
+// Aggregator collects selected records instead of printing them, and prints
+// what it found after all files are searched, e.g., --uniq. Files may be
+// searched concurrently, so add() has to be safe for that.
+type Aggregator interface {
+    add(name string, e Entry)
+    print(w *bufio.Writer)
+}
+
+var aggregators []Aggregator
+
+type ContextPrinter struct {
+    w          *bufio.Writer
+    autoFlush  bool      // flush w after each record, e.g., for --follow
+    merge      chan<- Merged // send records here instead of w with --merge
+    name       string    // filename to print when multiple files are given
+    rotated    *RotatedReader // to tell the file of each record with --rotated
+    before     int
+    after      int
+    beforeTime time.Duration
+    afterTime  time.Duration
+    pending    []Entry   // records not printed yet, which may be leading context
+    left       int       // number of trailing context records still to print
+    until      time.Time // trailing context by time lasts until this
+    lastNum    int       // number of the record printed last, 0 if none yet
+    delta      Delta     // for --delta
+}
+
+func NewContextPrinter(w *bufio.Writer, name string, before, after int) *ContextPrinter {
+    c := new(ContextPrinter)
+    c.w = w
+    c.name = name
+    c.before = before
+    c.after = after
+    return c
+}
+
+// hasContext reports whether context records are printed, so that groups
+// of records have to be separated.
+func (c *ContextPrinter) hasContext() bool {
+    return c.before > 0 || c.after > 0 || c.beforeTime > 0 || c.afterTime > 0
+}
+
+// needTime reports whether Entry.ts has to be set for Print()
+func (c *ContextPrinter) needTime() bool {
+    return c.beforeTime > 0 || c.afterTime > 0 || c.merge != nil || len(aggregators) > 0 || *optDelta
+}
+
+func (c *ContextPrinter) emit(e Entry, matched bool) {
+    name := c.name
+    if c.rotated != nil {
+        name, e = c.rotated.locate(e)
+    }
+    if len(aggregators) > 0 {
+        if matched {
+            for _, s := range aggregators {
+                s.add(name, e)
+            }
+        }
+        return
+    }
+    if c.merge != nil {
+        // group separators make no sense in merged output
+        c.merge <- Merged{name, e, matched}
+        c.lastNum = e.num
+        return
+    }
+    if c.lastNum > 0 && e.num != c.lastNum+1 && c.hasContext() {
+        io.WriteString(c.w, GROUP_SEPARATOR + recordTerminator())
+    }
+    note := ""
+    if *optDelta {
+        note = c.delta.prefix(e, matched)
+    }
+    writeAnnotated(c.w, name, e, matched, note)
+    c.lastNum = e.num
+    if c.autoFlush {
+        c.w.Flush()
+    }
+}
+
+// trailing reports whether next record may still be trailing context
+func (c *ContextPrinter) trailing() bool {
+    return c.left > 0 || !c.until.IsZero()
+}
+
+// isBefore reports whether pending record p is leading context of e
+func (c *ContextPrinter) isBefore(p, e Entry) bool {
+    if e.num-p.num <= c.before {
+        return true
+    }
+    return c.beforeTime > 0 && !p.ts.IsZero() && !p.ts.Before(e.ts.Add(-c.beforeTime))
+}
+
+// Print is called for every record in the input, in order.
+func (c *ContextPrinter) Print(e Entry, matched bool) {
+    if matched {
+        for _, p := range c.pending {
+            if c.isBefore(p, e) {
+                c.emit(p, false)
+            }
+        }
+        c.pending = c.pending[:0]
+        c.emit(e, true)
+        c.left = c.after
+        if c.afterTime > 0 && !e.ts.IsZero() {
+            c.until = e.ts.Add(c.afterTime)
+        } else {
+            c.until = time.Time{}
+        }
+        return
+    }
+    if c.left > 0 || (!c.until.IsZero() && !e.ts.After(c.until)) {
+        c.emit(e, false)
+        if c.left > 0 {
+            c.left--
+        }
+        return
+    }
+    c.until = time.Time{}
+    if c.before > 0 || c.beforeTime > 0 {
+        // keep only records which can be leading context of next record
+        i := 0
+        for i < len(c.pending) && !c.isBefore(c.pending[i], Entry{num: e.num+1, ts: e.ts}) {
+            i++
+        }
+        c.pending = append(c.pending[i:], e)
+    }
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "fmt"
+    "testing"
+)
+
+// printContext prints records "r1\n" to "rN\n" through a ContextPrinter,
+// where records numbered in 'matches' are matched.
+func printContext(n int, matches []int, before, after int) string {
+    var buf bytes.Buffer
+    w := bufio.NewWriter(&buf)
+    c := NewContextPrinter(w, "test", before, after)
+    matched := make(map[int]bool)
+    for _, m := range matches {
+        matched[m] = true
+    }
+    var offset int64
+    for i := 1; i <= n; i++ {
+        e := Entry{text: fmt.Sprintf("r%d\n", i), num: i, line: i, offset: offset}
+        offset += int64(len(e.text))
+        c.Print(e, matched[i])
+    }
+    w.Flush()
+    return buf.String()
+}
+
+func TestContextPrinter(t *testing.T) {
+    tests := []struct {
+        name    string
+        matches []int
+        before  int
+        after   int
+        want    string
+    }{
+        {"no context", []int{2, 4}, 0, 0, "r2\nr4\n"},
+        {"-B trims to NUM records", []int{4}, 2, 0, "r2\nr3\nr4\n"},
+        {"-B at the beginning", []int{1}, 2, 0, "r1\n"},
+        {"-A trims to NUM records", []int{2}, 0, 2, "r2\nr3\nr4\n"},
+        {"-A at the end", []int{6}, 0, 2, "r6\n"},
+        {"-C", []int{3}, 1, 1, "r2\nr3\nr4\n"},
+        {"separator between groups", []int{1, 5}, 0, 1, "r1\nr2\n--\nr5\nr6\n"},
+        {"adjacent groups", []int{1, 4}, 1, 1, "r1\nr2\nr3\nr4\nr5\n"},
+        {"overlapping context", []int{2, 3}, 1, 1, "r1\nr2\nr3\nr4\n"},
+        {"-B with a gap", []int{2, 6}, 1, 0, "r1\nr2\n--\nr5\nr6\n"},
+    }
+    for _, tt := range tests {
+        if got := printContext(6, tt.matches, tt.before, tt.after); got != tt.want {
+            t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+        }
+    }
+}
+
+func TestContextMaxCount(t *testing.T) {
+    *optMaxCount = 1
+    defer func() { *optMaxCount = -1 }()
+    input := recA + recB + recC + "2026-10-01 10:00:03 a\n"
+
+    // trailing context of the last match is printed, even if it matches,
+    // and then reading stops
+    got, end := grepContext("a|b", input, Position{}, 0, 1)
+    if want := recA + recB; got != want {
+        t.Errorf("-m 1 -A 1: got %q, want %q", got, want)
+    }
+    if end.Records != 2 || end.Offset != int64(len(recA + recB)) {
+        t.Errorf("-m 1 -A 1: stopped at %+v, want after record 2", end)
+    }
+
+    // without context, reading stops right after the match
+    got, end = grepContext("a", input, Position{}, 0, 0)
+    if got != recA || end.Records != 1 {
+        t.Errorf("-m 1: got %q, stopped at %+v", got, end)
+    }
+}
+
+func TestContextSize(t *testing.T) {
+    defer func() { *optContext = 0 }()
+    *optContext = 1
+    tests := []struct {
+        n    int
+        want int
+    }{
+        {-1, 1}, // not given; -C
+        {0, 0},  // -C 1 -B 0 prints no leading context, like grep
+        {3, 3},
+    }
+    for _, tt := range tests {
+        if got := contextSize(tt.n); got != tt.want {
+            t.Errorf("contextSize(%d) with -C 1: got %d, want %d", tt.n, got, tt.want)
+        }
+    }
+    *optContext = 0
+    if got := contextSize(-1); got != 0 {
+        t.Errorf("contextSize(-1) without -C: got %d, want 0", got)
+    }
+    // separators are printed only with context
+    if got := printContext(3, []int{1, 3}, contextSize(-1), contextSize(-1)); got != "r1\nr3\n" {
+        t.Errorf("no context: got %q", got)
+    }
+}
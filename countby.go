@@ -0,0 +1,107 @@
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "io"
+    "sort"
+    "strings"
+    "sync"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// Counting selected records by a captured value (--count-by)
+//
+// The value of a record is what the first capture group of --count-by
+// regex matched first in it, or the whole match if the regex has no
+// group. Values are printed with numbers of records, most frequent first;
+// records without value are counted as NO_VALUE.
+
+const NO_VALUE = "(no value)"
+
+type CountBy struct {
+    re     Regexp
+    group  int    // capture group of the value; 0 for whole match
+    name   string // name of the group, if named
+    lock   sync.Mutex
+    counts map[string]int
+}
+
+func NewCountBy(pat string) *CountBy {
+    c := &CountBy{re: reComp(pat), counts: make(map[string]int)}
+    if c.re.r.Groups() > 0 {
+        c.group = 1
+        c.name = groupName(pat)
+    }
+    return c
+}
+
+// groupName returns name of the first group if it is named, e.g., 'exc'
+// for '(?P<exc>\w+Exception)'.
+func groupName(pat string) string {
+    for i := strings.IndexByte(pat, '('); i >= 0; i = strings.IndexByte(pat, '(') {
+        if i > 0 && pat[i-1] == '\\' {
+            pat = pat[i+1:]
+            continue
+        }
+        rest := pat[i+1:]
+        for _, p := range []string{"?P<", "?<", "?'"} {
+            if strings.HasPrefix(rest, p) {
+                rest = rest[len(p):]
+                if end := strings.IndexAny(rest, ">'"); end > 0 {
+                    return rest[:end]
+                }
+            }
+        }
+        if !strings.HasPrefix(rest, "?") {
+            return "" // the first group is not named
+        }
+        pat = rest
+    }
+    return ""
+}
+
+func (c *CountBy) add(name string, e Entry) {
+    value := NO_VALUE
+    if locs := c.re.FindAllIndex(unsafeStrToByte(e.text), c.group); len(locs) > 0 {
+        value = e.text[locs[0][0]:locs[0][1]]
+    }
+    c.lock.Lock()
+    c.counts[value]++
+    c.lock.Unlock()
+}
+
+type jsonCount struct {
+    Group string `json:"group,omitempty"`
+    Value string `json:"value"`
+    Count int    `json:"count"`
+}
+
+// print shows values and counts like 'sort | uniq -c | sort -rn', up to
+// --top values if given.
+func (c *CountBy) print(w *bufio.Writer) {
+    values := make([]string, 0, len(c.counts))
+    for v := range c.counts {
+        values = append(values, v)
+    }
+    sort.Slice(values, func(i, j int) bool {
+        if c.counts[values[i]] != c.counts[values[j]] {
+            return c.counts[values[i]] > c.counts[values[j]]
+        }
+        return values[i] < values[j]
+    })
+    if *optTop > 0 && len(values) > *optTop {
+        values = values[:*optTop]
+    }
+    for _, v := range values {
+        if *optOutput == "jsonl" {
+            b, err := json.Marshal(jsonCount{c.name, v, c.counts[v]})
+            checkError(err)
+            w.Write(append(b, '\n'))
+            continue
+        }
+        io.WriteString(w, fmt.Sprintf("%8d  %s\n", c.counts[v], v))
+    }
+    w.Flush()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "compress/bzip2"
+    "compress/gzip"
+    "io"
+    "io/ioutil"
+    zstd "github.com/klauspost/compress/zstd"
+    xz "github.com/ulikunitz/xz"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// Transparent decompression
+//
+// Compressed input is detected by magic bytes rather than filename
+// extension, so that rotated logs like 'app.log.1' which are actually
+// gzipped are handled, too.
+
+var (
+    magicGzip  = []byte{0x1f, 0x8b}
+    magicBzip2 = []byte("BZh")
+    magicXz    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+    magicZstd  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+func isCompressed(magic []byte) bool {
+    for _, m := range [][]byte{magicGzip, magicBzip2, magicXz, magicZstd} {
+        if bytes.HasPrefix(magic, m) {
+            return true
+        }
+    }
+    return false
+}
+
+// decompress returns a reader to read decompressed data from r, or r itself
+// (with buffering) if r is not compressed. It has to be closed to release
+// the decompressor, which doesn't close r.
+func decompress(r io.Reader) (io.ReadCloser, error) {
+    br := bufio.NewReader(r)
+    magic, _ := br.Peek(len(magicXz))
+    switch {
+    case bytes.HasPrefix(magic, magicGzip):
+        g, err := gzip.NewReader(br)
+        if err != nil {
+            return nil, err
+        }
+        return g, nil
+    case bytes.HasPrefix(magic, magicBzip2):
+        return ioutil.NopCloser(bzip2.NewReader(br)), nil
+    case bytes.HasPrefix(magic, magicXz):
+        x, err := xz.NewReader(br)
+        if err != nil {
+            return nil, err
+        }
+        return ioutil.NopCloser(x), nil
+    case bytes.HasPrefix(magic, magicZstd):
+        d, err := zstd.NewReader(br)
+        if err != nil {
+            return nil, err
+        }
+        return d.IOReadCloser(), nil
+    }
+    return ioutil.NopCloser(br), nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+    "fmt"
+    "time"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// Time deltas between records (--delta)
+//
+// Each printed record is prefixed with time elapsed since the previous
+// selected record, and since the first one with --delta-first. Records
+// without their own timestamp are marked with NO_TIME instead. With
+// --merge, deltas are of the merged stream; otherwise of each file.
+
+const NO_TIME = "no-time"
+
+type Delta struct {
+    prev, first time.Time
+}
+
+func formatDelta(d time.Duration) string {
+    return fmt.Sprintf("%+.3fs", d.Seconds())
+}
+
+// column formats values for the prefix, with the second one only with
+// --delta-first.
+func column(since, sinceFirst string) string {
+    if *optDeltaFirst {
+        return fmt.Sprintf("%10s %10s ", since, sinceFirst)
+    }
+    return fmt.Sprintf("%10s ", since)
+}
+
+// prefix returns the text to print before the record. Counting starts at
+// the first selected record; context records before it have blank prefix.
+func (d *Delta) prefix(e Entry, matched bool) string {
+    if !e.timed {
+        return column(NO_TIME, "")
+    }
+    if d.first.IsZero() {
+        if !matched {
+            return column("", "")
+        }
+        d.first, d.prev = e.ts, e.ts
+    }
+    p := column(formatDelta(e.ts.Sub(d.prev)), formatDelta(e.ts.Sub(d.first)))
+    if matched {
+        d.prev = e.ts
+    }
+    return p
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+    "io"
+    "os"
+    "sync"
+    "time"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// Follow mode (--follow)
+//
+// Like 'tail -F', but searches the file from the beginning and keeps
+// reading as it grows. A record is complete only when next RS arrives,
+// so Follower returns EOF once the file has been idle for --flush-after,
+// to let mlrgrep_srf flush the last record; then scanning resumes.
+// The file is reopened when the path is rotated to a new inode, and read
+// from the beginning again if it is truncated.
+
+const FOLLOW_POLL_INTERVAL = 200 * time.Millisecond
+
+type Follower struct {
+    name  string
+    file  *os.File
+    idle  time.Duration   // return EOF after this long without new data
+    fresh bool            // read some data since last EOF
+    done  <-chan struct{} // closed when no more data is needed, e.g., -m NUM
+}
+
+func NewFollower(name string, idle time.Duration) (*Follower, error) {
+    file, err := os.Open(name)
+    if err != nil {
+        return nil, err
+    }
+    return &Follower{name: name, file: file, idle: idle}, nil
+}
+
+func (f *Follower) Close() error {
+    return f.file.Close()
+}
+
+// rotated reports whether the path now refers to another file. It also
+// rewinds the file if it got truncated (e.g., logrotate's copytruncate).
+func (f *Follower) rotated() bool {
+    cur, err := f.file.Stat()
+    if err != nil {
+        return false
+    }
+    pos, err := f.file.Seek(0, io.SeekCurrent)
+    if err == nil && cur.Size() < pos {
+        debug("%s: truncated\n", f.name)
+        f.file.Seek(0, io.SeekStart)
+    }
+    fi, err := os.Stat(f.name)
+    if err != nil {
+        return false // rotated, but new file is not created yet
+    }
+    return !os.SameFile(cur, fi)
+}
+
+func (f *Follower) reopen() {
+    file, err := os.Open(f.name)
+    if err != nil {
+        return
+    }
+    debug("%s: reopened\n", f.name)
+    f.file.Close()
+    f.file = file
+}
+
+func (f *Follower) Read(p []byte) (int, error) {
+    var waited time.Duration
+    for {
+        n, err := f.file.Read(p)
+        if n > 0 {
+            f.fresh = true
+            return n, nil
+        }
+        if err != nil && err != io.EOF {
+            return 0, err
+        }
+        if f.rotated() {
+            // rest of the old file was already read with the Read() above
+            f.reopen()
+            continue
+        }
+        if f.fresh && waited >= f.idle {
+            f.fresh = false
+            return 0, io.EOF
+        }
+        select {
+        case <-f.done:
+            return 0, io.EOF
+        case <-time.After(FOLLOW_POLL_INTERVAL):
+        }
+        waited += FOLLOW_POLL_INTERVAL
+    }
+}
+
+// Records from followed files are printed as soon as they are found, and
+// as a whole even if multiple files are followed concurrently.
+var stdoutLock sync.Mutex
+
+type lockedWriter struct {
+    w io.Writer
+}
+
+func (l lockedWriter) Write(p []byte) (int, error) {
+    stdoutLock.Lock()
+    defer stdoutLock.Unlock()
+    return l.w.Write(p)
+}
+
+func flushAfter() time.Duration {
+    d, err := time.ParseDuration(*optFlushAfter)
+    checkError(err)
+    return d
+}
+
+func followFile(pat string, rs string, name string) {
+    f, err := NewFollower(name, flushAfter())
+    if err != nil {
+        warn("%s", err)
+        return
+    }
+    defer f.Close()
+    mlrgrep_srf(pat, rs, name, f, Position{}, nil)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+    "io"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+func TestFollowerStopsWhenDone(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "app.log")
+    writeFile(t, path, recA)
+    f, err := NewFollower(path, time.Hour)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer f.Close()
+    done := make(chan struct{})
+    f.done = done
+
+    buf := make([]byte, 4096)
+    if n, err := f.Read(buf); string(buf[:n]) != recA || err != nil {
+        t.Fatalf("got %q %v, want %q", buf[:n], err, recA)
+    }
+    // idle, and nobody needs more; e.g., reached -m NUM
+    go func() {
+        time.Sleep(2 * FOLLOW_POLL_INTERVAL)
+        close(done)
+    }()
+    begin := time.Now()
+    n, err := f.Read(buf)
+    if n != 0 || err != io.EOF {
+        t.Errorf("got %d %v, want EOF", n, err)
+    }
+    if waited := time.Since(begin); waited > 5 * FOLLOW_POLL_INTERVAL {
+        t.Errorf("returned %s after done", waited)
+    }
+}
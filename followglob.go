@@ -0,0 +1,58 @@
+package main
+
+import (
+    "path/filepath"
+    "sync"
+    "time"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// Following files matching a glob (--follow-glob)
+//
+// Files which match the glob, including ones created later, are followed
+// from the beginning, each by followFile(). New files are noticed by
+// inotify on the directory part of the glob where available, and by
+// polling otherwise (or if the directory part has wildcards).
+
+const (
+    GLOB_POLL_INTERVAL        = 1 * time.Second
+    GLOB_POLL_INTERVAL_NOTIFY = 10 * time.Second // just in case events are lost
+)
+
+func followGlob(pat string, rs string, glob string) {
+    if _, err := filepath.Match(glob, ""); err != nil {
+        warn("%s: %s", glob, err)
+        return
+    }
+    var wg sync.WaitGroup
+    following := make(map[string]bool)
+    rescan := func() {
+        names, _ := filepath.Glob(glob)
+        for _, name := range names {
+            if following[name] {
+                continue
+            }
+            following[name] = true
+            debug("follow %s\n", name)
+            wg.Add(1)
+            go func(name string) {
+                defer wg.Done()
+                followFile(pat, rs, name)
+            }(name)
+        }
+    }
+
+    interval := GLOB_POLL_INTERVAL
+    notify := watchDir(filepath.Dir(glob))
+    if notify != nil {
+        interval = GLOB_POLL_INTERVAL_NOTIFY
+    }
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for rescan(); ; rescan() {
+        select {
+        case <-notify:
+        case <-ticker.C:
+        }
+    }
+}
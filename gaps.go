@@ -0,0 +1,94 @@
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "io"
+    "strings"
+    "sync"
+    "time"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// Gaps and disorder in timestamps (--gaps)
+//
+// Timestamps of consecutive selected records in each file are compared,
+// and places where they are more than the threshold apart, or go
+// backwards, are printed with the records on either side instead of all
+// records. Records without timestamp are not compared.
+
+type gap struct {
+    before, after Seen
+}
+
+func (g gap) backwards() bool {
+    return g.after.e.ts.Before(g.before.e.ts)
+}
+
+type Gaps struct {
+    threshold time.Duration
+    lock      sync.Mutex
+    last      map[string]Seen
+    gaps      []gap
+}
+
+func NewGaps(threshold time.Duration) *Gaps {
+    return &Gaps{threshold: threshold, last: make(map[string]Seen)}
+}
+
+func (g *Gaps) add(name string, e Entry) {
+    if !e.timed { // ts is inherited from the previous record, if any
+        return
+    }
+    g.lock.Lock()
+    defer g.lock.Unlock()
+    cur := Seen{name, e}
+    if prev, ok := g.last[name]; ok {
+        if d := e.ts.Sub(prev.e.ts); d < 0 || d > g.threshold {
+            g.gaps = append(g.gaps, gap{prev, cur})
+        }
+    }
+    g.last[name] = cur
+}
+
+type jsonGap struct {
+    Kind         string   `json:"kind"` // "gap" or "backwards"
+    Seconds      float64  `json:"seconds"`
+    Before       jsonSeen `json:"before"`
+    After        jsonSeen `json:"after"`
+    BeforeRecord string   `json:"before_record"`
+    AfterRecord  string   `json:"after_record"`
+}
+
+func (g *Gaps) print(w *bufio.Writer) {
+    defer w.Flush()
+    for _, gp := range g.gaps {
+        d := gp.after.e.ts.Sub(gp.before.e.ts)
+        if *optOutput == "jsonl" {
+            kind := "gap"
+            if gp.backwards() {
+                kind = "backwards"
+            }
+            b, err := json.Marshal(jsonGap{kind, d.Seconds(), gp.before.json(), gp.after.json(),
+                                           gp.before.e.text, gp.after.e.text})
+            checkError(err)
+            w.Write(append(b, '\n'))
+            continue
+        }
+        what := "gap of " + d.String()
+        if gp.backwards() {
+            what = "backwards by " + (-d).String()
+        }
+        io.WriteString(w, fmt.Sprintf("%s %s between %s and %s%s", GROUP_SEPARATOR, what,
+                                      gp.before, gp.after, recordTerminator()))
+        for _, s := range []Seen{gp.before, gp.after} {
+            e := s.e
+            e.text = strings.TrimLeft(e.text, "\n")
+            writeEntry(w, s.name, e, true)
+            if !strings.HasSuffix(e.text, "\n") && !nullOutput() {
+                io.WriteString(w, "\n")
+            }
+        }
+    }
+}
@@ -7,10 +7,12 @@ import (
     "bytes"
     "errors"
     "bufio"
-    "sync"
+    "io/ioutil"
     "strings"
+    "sync"
     "unsafe"
     "reflect"
+    "time"
     goopt "github.com/droundy/goopt"
     //"regexp"
     //sre2  "github.com/samthor/sre2"
@@ -21,11 +23,12 @@ var Usage = "gmlgrep [OPTIONS...] PATTERN[...] [--] [FILES...]"
 var Summary = `
   grep(1) like tool, but "record-oriented", instead of line-oriented.
   Useful to search/print multi-line log entries separated by e.g., empty
-  lines, '----' or timestamps, etc. If an argument in argument list is a
-  name of existing file or '-' (means stdin), such argument and all arguments
-  after that will be treated as filenames to read from. Otherwise arguments
-  are considered to be regex to search. (could be confusing if you specify
-  nonexistent filename!)`
+  lines, '----' or timestamps, etc. The first argument is always a regex.
+  If a later argument is a name of existing file or directory, or '-'
+  (means stdin), such argument and all arguments after that will be
+  treated as filenames to read from. Otherwise arguments are considered to
+  be regex to search. (could be confusing if you specify nonexistent
+  filename!)`
 
 // The Flag function creates a boolean flag, possibly with a negating
 // alternative.  Note that you can specify either long or short flags
@@ -42,12 +45,108 @@ var optTimestamp  = goopt.Flag([]string{"-t", "--timestamp"}, nil,
     "Same as --rs=TIMESTAMP_REGEX, where the regex matches timestamps often used in log files, e.g., '2014-12-31 12:34:56' or 'Dec 31 12:34:56'.", "")
 var optColor = goopt.Flag([]string{"--color", "--hl"}, nil,
     "Highlight matches. Default is enabled iff stdout is a TTY.", "")
+var optAfter = goopt.IntWithLabel([]string{"-A", "--after-context"}, -1, "NUM",
+    "Print NUM records of trailing context after matching records.")
+var optBefore = goopt.IntWithLabel([]string{"-B", "--before-context"}, -1, "NUM",
+    "Print NUM records of leading context before matching records.")
+var optContext = goopt.IntWithLabel([]string{"-C", "--context"}, 0, "NUM",
+    "Print NUM records of output context. (same as -A NUM -B NUM)")
+var optAfterTime = goopt.StringWithLabel([]string{"--after-time"}, "", "DURATION",
+    "Print records with timestamps within DURATION (e.g., '5s', '1m30s') after matching records.")
+var optBeforeTime = goopt.StringWithLabel([]string{"--before-time"}, "", "DURATION",
+    "Print records with timestamps within DURATION before matching records.")
+var optContextTime = goopt.StringWithLabel([]string{"--context-time"}, "", "DURATION",
+    "Same as --after-time=DURATION --before-time=DURATION.")
+var optMaxCount = goopt.IntWithLabel([]string{"-m", "--max-count"}, -1, "NUM",
+    "Stop reading a file after NUM matching records. (same as grep -m)")
+var optLineNumber = goopt.Flag([]string{"-n", "--line-number"}, nil,
+    "Prefix each output line with its line number in the file.", "")
+var optRecordNumber = goopt.Flag([]string{"--record-number"}, nil,
+    "Prefix each output line with the number of the record in the file.", "")
+var optByteOffset = goopt.Flag([]string{"-b", "--byte-offset"}, nil,
+    "Prefix each output line with the byte offset of the record in the file.", "")
+var optOnlyMatching = goopt.Flag([]string{"-o", "--only-matching"}, nil,
+    "Print only matched parts of matching records, each with record and line number.", "")
+var optOnlyGroup = goopt.IntWithLabel([]string{"--only-group"}, 0, "NUM",
+    "With -o, print NUM-th capture group instead of whole match.")
+var optOutput = goopt.Alternatives([]string{"--output"}, []string{"text", "jsonl"},
+    "Output format. 'jsonl' prints a JSON object per matching record, with its location, separator, body and match spans.")
+var optNull = goopt.Flag([]string{"--null"}, nil,
+    "Terminate each output record with NUL, e.g., for 'xargs -0'.", "")
+var optNullData = goopt.Flag([]string{"-z", "--null-data"}, nil,
+    "Input records are terminated by NUL instead of RS. Implies --null.", "")
+var optDecompress = goopt.Flag([]string{"-Z", "--decompress"}, nil,
+    "Decompress standard input and search archives in it. Compressed files (gzip, bzip2, xz and zstd) are always decompressed.", "")
+var optRecursive = goopt.Flag([]string{"-R", "--recursive"}, nil,
+    "Search files under directories recursively. Current directory is searched if no file is given.", "")
+var optFollowSymlinks = goopt.Flag([]string{"--follow-symlinks"}, nil,
+    "Follow symbolic links found while searching directories recursively.", "")
+var optInclude = goopt.Strings([]string{"--include"}, "GLOB",
+    "Search only files whose name matches GLOB in directories or archives. Can be given multiple times.")
+var optExclude = goopt.Strings([]string{"--exclude"}, "GLOB",
+    "Skip files whose name matches GLOB in directories or archives.")
+var optExcludeDir = goopt.Strings([]string{"--exclude-dir"}, "GLOB",
+    "Skip directories whose base name matches GLOB.")
+var optFollow = goopt.Flag([]string{"--follow"}, nil,
+    "Keep reading files as they grow, like 'tail -F', reopening them when rotated.", "")
+var optFlushAfter = goopt.StringWithLabel([]string{"--flush-after"}, "2s", "DURATION",
+    "With --follow, print the last record after the file is idle for DURATION, without waiting for next RS.")
+var optFollowGlob = goopt.Strings([]string{"--follow-glob"}, "GLOB",
+    "Follow files matching GLOB, including ones created later. Quote GLOB to keep it from the shell. Implies --follow.")
+var optStateFile = goopt.StringWithLabel([]string{"--state-file"}, "", "PATH",
+    "Remember in PATH where each file was read up to, and resume from the next record in the next run.")
+var optSince = goopt.StringWithLabel([]string{"--since"}, "", "TIME",
+    "Search only records with timestamps at or after TIME; e.g., '2014-12-31 12:34', '12:34', or '--since=-15m' for relative to now.")
+var optUntil = goopt.StringWithLabel([]string{"--until"}, "", "TIME",
+    "Search only records with timestamps before TIME. Records without timestamp have the time of the previous record.")
+var optTimeFormat = goopt.StringWithLabel([]string{"--time-format"}, "", "LAYOUT",
+    "Layout of timestamps at the beginning of records, in Go's time package format; e.g., '02/Jan/2006:15:04:05 -0700'. Default is to detect common formats.")
+var optTimezone = goopt.StringWithLabel([]string{"--timezone"}, "", "TZ",
+    "Timezone of timestamps without one, e.g., 'UTC' or 'Asia/Tokyo'. Default is local time.")
+var optSeekTime = goopt.StringWithLabel([]string{"--seek-time"}, "", "TIME",
+    "Binary search time-ordered files for the first record at or after TIME, instead of reading from the beginning. Line and record numbers are counted from there.")
+var optSeekEnd = goopt.StringWithLabel([]string{"--seek-end"}, "", "TIME",
+    "Stop reading time-ordered files at the first record at or after TIME.")
+var optRotated = goopt.Flag([]string{"--rotated"}, nil,
+    "Search each FILE together with its rotated files (e.g., FILE.1, FILE.2.gz, FILE-20261016) oldest first, as one stream.", "")
+var optUniq = goopt.Flag([]string{"--uniq"}, nil,
+    "Print each distinct selected record once with its count and where it was first and last seen.", "")
+var optNormalize = goopt.StringWithLabel([]string{"--normalize"}, "ts,uuid,hex,num", "LIST",
+    "Comma separated normalizations before comparing records for --uniq, --cluster and --baseline: ts (strip leading timestamps), uuid, hex, num (mask them), or none.")
+var optCluster = goopt.Flag([]string{"--cluster"}, nil,
+    "Group selected records into templates, where varying tokens are shown as <*>, and print them with counts and an example.", "")
+var optClusterSimilarity = goopt.IntWithLabel([]string{"--cluster-similarity"}, 50, "PERCENT",
+    "Minimum percentage of tokens a record shares with a template to join it for --cluster.")
+var optBaseline = goopt.Strings([]string{"--baseline"}, "FILE",
+    "Select only records whose shape, after --normalize, is not in FILE; a known-good log split with the same RS, or a set saved with --save-baseline. Can be given multiple times.")
+var optSaveBaseline = goopt.StringWithLabel([]string{"--save-baseline"}, "", "PATH",
+    "Save fingerprints of records in --baseline files to PATH, to be given to --baseline later.")
+var optHistogram = goopt.StringWithLabel([]string{"--histogram"}, "", "DURATION",
+    "Print numbers of selected records per DURATION (e.g., '1m') by their timestamps, instead of records; per pattern if multiple patterns are given.")
+var optCountBy = goopt.StringWithLabel([]string{"--count-by"}, "", "REGEX",
+    "Print numbers of selected records by the value REGEX captures in them (the first capture group, or whole match), instead of records.")
+var optTop = goopt.IntWithLabel([]string{"--top"}, 0, "NUM",
+    "With --count-by, print only NUM most frequent values.")
+var optStatsField = goopt.StringWithLabel([]string{"--stats-field"}, "", "REGEX",
+    "Print count, min, max, mean and percentiles of the number REGEX captures in selected records (the first capture group, or whole match), instead of records.")
+var optStatsBucket = goopt.StringWithLabel([]string{"--stats-bucket"}, "", "DURATION",
+    "With --stats-field, print statistics also per DURATION (e.g., '1m') by timestamps of records.")
+var optGaps = goopt.StringWithLabel([]string{"--gaps"}, "", "DURATION",
+    "Print places where timestamps of consecutive selected records are more than DURATION apart, or go backwards, with the records on either side, instead of all records.")
+var optDelta = goopt.Flag([]string{"--delta"}, nil,
+    "Prefix each printed record with time elapsed since the previous selected record, by their timestamps.", "")
+var optDeltaFirst = goopt.Flag([]string{"--delta-first"}, nil,
+    "With --delta, also print time elapsed since the first selected record.", "")
+var optMerge = goopt.Flag([]string{"--merge"}, nil,
+    "Search files concurrently and print matching records from all of them in order of their timestamps, tagged with filename.", "")
+var optBinaryFiles = goopt.Alternatives([]string{"--binary-files"}, []string{"skip", "text"},
+    "How to handle binary files (i.e., with NUL bytes) found in directories or archives. Files given explicitly are always searched.")
 
 const RS_REGEX = "^$|^(=====*|-----*)$"
 var rs = goopt.StringWithLabel([]string{"-r", "--rs"}, RS_REGEX, "RS_REGEX",
     fmt.Sprintf("Input record separator. default: /%s/", RS_REGEX))
 
-//const DATETIME_REGEX = ""
+const TIMESTAMP_REGEX = `^(\d{4}-\d\d-\d\d[T ]\d\d:\d\d:\d\d([.,]\d+)?(Z|[+-]\d\d:?\d\d)?|[A-Z][a-z][a-z] [ \d]\d \d\d:\d\d:\d\d)`
 
 
 //////////////////////////////////////////////////////////////////////////////
@@ -77,17 +176,64 @@ func reComp(restr string) Regexp {
     return Regexp{r, f}
 }
 
+// FindAllIndex returns locations of capture group 'n' (0 for whole match)
+// of all non-overlapping matches in d.
+func (re Regexp) FindAllIndex(d []byte, n int) [][]int {
+    var locs [][]int
+    pos := 0
+    for pos <= len(d) {
+        flags := 0
+        if pos > 0 && d[pos-1] != '\n' {
+            flags = pcre.NOTBOL
+        }
+        m := re.r.Matcher(d[pos:], flags)
+        if !m.Matches() {
+            break
+        }
+        whole := m.GroupIndices(0)
+        if loc := m.GroupIndices(n); loc != nil {
+            locs = append(locs, []int{pos + loc[0], pos + loc[1]})
+        }
+        if whole[1] == whole[0] {
+            pos += whole[1] + 1 // empty match
+        } else {
+            pos += whole[1]
+        }
+    }
+    return locs
+}
+
 
 
+// ReplaceAll returns d with all matches replaced by repl
+func (re Regexp) ReplaceAll(d []byte, repl string) string {
+    var b strings.Builder
+    pos := 0
+    for _, m := range re.FindAllIndex(d, 0) {
+        b.Write(d[pos:m[0]])
+        b.WriteString(repl)
+        pos = m[1]
+    }
+    b.Write(d[pos:])
+    return b.String()
+}
+
 //////////////////////////////////////////////////////////////////////////////
 
+// print filename with output, as grep(1) does for multiple files
+var withFilename bool
+
 func checkError(e error) {
     if e != nil {
-        fmt.Fprintf(os.Stdout, "ERROR: %d\n", e)
+        fmt.Fprintf(os.Stderr, "ERROR: %s\n", e)
         os.Exit(1)
     }
 }
 
+func warn(format string, args ...interface{}) {
+    fmt.Fprintf(os.Stderr, "gmlgrep: " + format + "\n", args...)
+}
+
 func debug(format string, args ...interface{}) {
     //fmt.Fprintf(os.Stderr, ">> DEBUG: " + format, args...)
 }
@@ -219,6 +365,7 @@ func NewSplitRecordFirstFinder(pat, rs string) *SplitRecordFirstFinder{
 
 func (s *SplitRecordFirstFinder) Split(data []byte, atEOF bool) (advance int, token []byte, err error) {
     s.rsPos = 0
+    s.rsSize = 0
     if atEOF && len(data) == 0 {
         return 0, nil, nil
     }
@@ -231,15 +378,41 @@ func (s *SplitRecordFirstFinder) Split(data []byte, atEOF bool) (advance int, to
             return 0, nil, nil //not enough data
         }
     }
-    if (pos+sz == 0) {
-        //FIXME: is this the best way to handle empty match?
-        // The only known case so far is when using /^$/ with (?m) flag
-        s.rsPos = 1
-        return 1, data[0:1], nil
-    } else {
-        s.rsPos = pos
-        return pos+sz, data[0:pos+sz], nil
+    // RS always covers the rest of the line it matched on, so that
+    // next record starts at the beginning of a line; otherwise an empty
+    // match such as /^$/ leaves the newline behind and we get a bogus
+    // one-byte record for every separator.
+    s.rsSize = sz
+    if (sz == 0 || data[pos+sz-1] != '\n') {
+        eol := bytes.IndexByte(data[pos+sz:], '\n')
+        if (eol < 0) {
+            if (!atEOF) {
+                return 0, nil, nil //RS line is not complete yet
+            }
+            sz = len(data) - pos
+        } else {
+            sz += eol + 1
+        }
+    }
+    s.rsPos = pos
+    return pos+sz, data[0:pos+sz], nil
+}
+
+// Split for --null-data; NUL terminates, rather than begins, a record and
+// is kept at the end of the record. No regex is involved.
+func (s *SplitRecordFirstFinder) SplitNull(data []byte, atEOF bool) (advance int, token []byte, err error) {
+    if atEOF && len(data) == 0 {
+        return 0, nil, nil
+    }
+    end := bytes.IndexByte(data, 0) + 1
+    if end == 0 {
+        if !atEOF {
+            return 0, nil, nil //not enough data
+        }
+        end = len(data)
     }
+    s.rsPos = end
+    return end, data[0:end], nil
 }
 
 
@@ -254,6 +427,52 @@ func (s *SplitRecordFirstFinder) Split(data []byte, atEOF bool) (advance int, to
 type Record struct {
     chunk string
     rsPos int
+    rsSize int // length of RS match at rsPos; RS continues to end of line
+}
+
+// RecordJoiner moves RS from the end of each Record to the beginning of
+// the next one, to make records as printed.
+type RecordJoiner struct {
+    rs     string // RS at the end of the last Record
+    rsSize int
+}
+
+// join returns the record which ends at RS of rec, and length of RS match
+// at its beginning. It is empty if the input starts with RS.
+func (j *RecordJoiner) join(rec Record) (string, int) {
+    text, rsSize := j.rs + rec.chunk[:rec.rsPos], j.rsSize
+    j.rs, j.rsSize = rec.chunk[rec.rsPos:], rec.rsSize
+    return text, rsSize
+}
+
+// last returns the last record, which consists of RS only, e.g., a single
+// timestamp line. It is empty if the input ended without RS.
+func (j *RecordJoiner) last() (string, int) {
+    return j.rs, j.rsSize
+}
+
+// A record as printed, i.e., RS of the previous Record followed by body
+type Entry struct {
+    text   string
+    rsLen  int       // length of RS match at the beginning of text, not
+                     // including the rest of its line
+    num    int       // 1-origin record number in the file
+    line   int       // 1-origin line number of the first line of the record
+    offset int64     // byte offset of the record in the file
+    ts     time.Time // timestamp at the beginning of the record, if any
+    timed  bool      // ts is of the record itself, not inherited
+    parts  []Part    // where it continues in later files, with --rotated
+    matches [][]int  // locations of matches in text, for -o
+}
+
+// Position in a file, as numbers of bytes, lines and records read so far
+type Position struct {
+    Offset  int64
+    Lines   int
+    Records int
+    // the file may be still being written; the last record at EOF is
+    // left for the next run as it may be incomplete (--state-file)
+    Growing bool `json:"-"`
 }
 
 func unsafeStrToByte(s string) []byte {
@@ -266,15 +485,19 @@ func unsafeStrToByte(s string) []byte {
     // need to take the length of s here to ensure s is live until after we update b's Data
     // field since the garbage collector can collect a variable once it is no longer used
     // not when it goes out of scope, for more details see https://github.com/golang/go/issues/9046
-    //l := len(s)
-    //byteHeader.Len = l
-    //byteHeader.Cap = l
+    l := len(s)
+    byteHeader.Len = l
+    byteHeader.Cap = l
     return b
 }
 
-func grep_record(pat string, pipe chan Record, wg* sync.WaitGroup) {
-    defer wg.Done()
-    var prevRS string
+// grep_record reads records from pipe and returns number of records
+// selected, and position after the last record it processed. It returns
+// without reading rest of the pipe once -m NUM records are selected and
+// trailing context of them are printed. 'start' is the position where
+// the first record in the pipe begins.
+func grep_record(pat string, pipe chan Record, out *ContextPrinter, start Position) (int, Position) {
+    var joiner RecordJoiner
     /*
     // plain text
     for rec := range pipe {
@@ -288,36 +511,182 @@ func grep_record(pat string, pipe chan Record, wg* sync.WaitGroup) {
 
     //regex
     re := reComp(pat)
+    var e Entry
+    e.offset = start.Offset
+    e.line = start.Lines + 1
+    e.num = start.Records
+    end := func() Position {
+        lines := e.line - 1 + strings.Count(e.text, "\n")
+        return Position{Offset: e.offset + int64(len(e.text)), Lines: lines, Records: e.num}
+    }
+    count := 0
+    past := false // past --seek-end
+    limit := func() bool {
+        return *optMaxCount >= 0 && count >= *optMaxCount
+    }
+    // reached -m NUM and printed trailing context of the last one
+    finished := func() bool {
+        return limit() && (*optCount || !out.trailing())
+    }
+    grep := func(rsLen int, text string) {
+        if e.text != "" {
+            e.offset += int64(len(e.text))
+            e.line += strings.Count(e.text, "\n")
+        }
+        e.text = text
+        e.rsLen = rsLen
+        e.num++
+        if out.needTime() || timeFilter() {
+            // records without timestamp inherit one from the previous record
+            var ts time.Time
+            if ts, e.timed = recordTime(e.text); e.timed {
+                e.ts = ts
+            }
+            if !seekEnd.IsZero() && !e.ts.Before(seekEnd) {
+                past = true
+                return
+            }
+            if timeFilter() && !inTimeRange(e) {
+                return
+            }
+        }
+        matched := false
+        if !limit() {
+            matched = (re.FindIndex( unsafeStrToByte(e.text) ) != nil) != *optInvert
+            if matched && baseline != nil && baseline.known(e.text) {
+                matched = false
+            }
+        }
+        if matched {
+            count++
+        }
+        e.matches = nil
+        if matched && (*optOnlyMatching || *optOutput == "jsonl") && !*optInvert {
+            // empty matches are not printed, as with 'grep -o'
+            for _, m := range re.FindAllIndex(unsafeStrToByte(e.text), *optOnlyGroup) {
+                if m[1] > m[0] {
+                    e.matches = append(e.matches, m)
+                }
+            }
+        }
+        if !*optCount {
+            out.Print(e, matched)
+        }
+    }
     for rec := range pipe {
-        //if ( re.FindIndex([]byte(rec.chunk)) != nil ) {
-        if ( re.FindIndex( unsafeStrToByte(rec.chunk) ) != nil ) {
-            fmt.Print(prevRS)
-            fmt.Print(rec.chunk[:rec.rsPos])
+        if finished() || past {
+            return count, end()
+        }
+        // RS belongs to the beginning of the record it precedes, so match
+        // and print the record as the user sees it.
+        if text, rsSize := joiner.join(rec); text != "" {
+            grep(rsSize, text)
         }
-        prevRS = rec.chunk[rec.rsPos:]
-        //fmt.Println(">>'" + prevRS + "'")
     }
+    // The last record is left for the next run if it may be incomplete yet.
+    if text, rsSize := joiner.last(); text != "" && !finished() && !past && !start.Growing {
+        grep(rsSize, text)
+    }
+    return count, end()
 }
 
 
-func mlrgrep_srf(pat string, rs string, r io.Reader) {
-    var wg sync.WaitGroup
+// mlrgrep_srf searches r, which is at 'start' of the file, and returns
+// the position after the last record processed.
+func mlrgrep_srf(pat string, rs string, name string, r io.Reader, start Position, merge chan<- Merged) Position {
+    follower, following := r.(*Follower)
     w := bufio.NewWriter(os.Stdout)
+    if following {
+        w = bufio.NewWriterSize(lockedWriter{os.Stdout}, 64 * 1024)
+    }
     pipe := make(chan Record, 128)
-    scanner := bufio.NewScanner(r)
     splitter := NewSplitRecordFirstFinder(pat, rs)
+    out := NewContextPrinter(w, name, contextSize(*optBefore), contextSize(*optAfter))
+    out.beforeTime = contextTime(*optBeforeTime)
+    out.afterTime = contextTime(*optAfterTime)
+    if *optOutput == "jsonl" {
+        // context records are not part of JSON output
+        out = NewContextPrinter(w, name, 0, 0)
+    }
+    out.autoFlush = following
+    out.merge = merge
+    if rr, ok := r.(*RotatedReader); ok {
+        out.rotated = rr
+    }
 
-    scanner.Split(splitter.Split)
-    wg.Add(1)
-    go grep_record(pat, pipe, &wg)
-
-    for scanner.Scan() {
-        rec := scanner.Text()
-        pipe <- Record{chunk: rec, rsPos: splitter.rsPos}
+    done := make(chan struct{})
+    if following {
+        follower.done = done
+    }
+    count := 0
+    end := start
+    go func() {
+        defer close(done)
+        count, end = grep_record(pat, pipe, out, start)
+    }()
+
+    // send records to grep_record until EOF; returns false if grep_record
+    // doesn't need more.
+    scan := func() bool {
+        scanner := bufio.NewScanner(r)
+        if *optNullData {
+            scanner.Split(splitter.SplitNull)
+        } else {
+            scanner.Split(splitter.Split)
+        }
+        // If the file is growing, the last Record is held back until next
+        // one arrives, as it is not sent if it is incomplete at EOF.
+        hold := start.Growing
+        var held *Record
+        send := func(rec *Record) bool {
+            select {
+            case pipe <- *rec:
+                return true
+            case <-done: // e.g., reached -m NUM; stop reading the file
+                return false
+            }
+        }
+        for scanner.Scan() {
+            rec := &Record{chunk: scanner.Text(), rsPos: splitter.rsPos, rsSize: splitter.rsSize}
+            if hold {
+                rec, held = held, rec
+                if rec == nil {
+                    continue
+                }
+            }
+            if !send(rec) {
+                return false
+            }
+        }
+        if held != nil && !incomplete(held) && !send(held) {
+            return false
+        }
+        if scanner.Err() != nil {
+            warn("%s: %s", name, scanner.Err())
+            return false
+        }
+        return true
+    }
+    for scan() && following {
+        // Follower was idle for a while; an empty Record makes
+        // grep_record print the last record, which would otherwise wait
+        // for next RS. Then scan again from where the file has grown.
+        select {
+        case pipe <- Record{}:
+        case <-done: // e.g., reached -m NUM; Follower.Read returned
+            following = false
+        }
     }
     close(pipe)
-    wg.Wait()
+    <-done
+    if *optCount {
+        if withFilename {
+            fmt.Fprintf(w, "%s:", name)
+        }
+        fmt.Fprintf(w, "%d\n", count)
+    }
     w.Flush()
+    return end
 }
 
 //Find Pattern First
@@ -339,6 +708,101 @@ func mlrgrep_fpf(pat string, rs string, r io.Reader) {
 
 
 
+// isBinary peeks the beginning of r for NUL bytes
+func isBinary(r *bufio.Reader) bool {
+    head, _ := r.Peek(8 * 1024)
+    return bytes.IndexByte(head, 0) >= 0
+}
+
+// grepStream searches r, labeling output with 'label'. If 'detect', r can
+// be compressed and/or a tar or zip archive. Binary data is skipped if
+// 'skipBinary'. 'start' is the position of r in the file, and position
+// after the last record processed is returned. Positions are not tracked
+// for archives.
+func grepStream(pat string, rs string, label string, r io.Reader, detect bool, skipBinary bool, start Position, merge chan<- Merged) Position {
+    if detect {
+        dr, e := decompress(r)
+        if e != nil {
+            warn("%s: %s", label, e)
+            return start
+        }
+        defer dr.Close()
+        r = dr
+    }
+    br := bufio.NewReader(r)
+    switch {
+    case detect && isTar(br):
+        grepTar(pat, rs, label, br, merge)
+    case detect && isZip(br):
+        grepZipStream(pat, rs, label, br, merge)
+    case skipBinary && !*optNullData && isBinary(br):
+        debug("skip binary file %s\n", label)
+    default:
+        return mlrgrep_srf(pat, rs, label, br, start, merge)
+    }
+    return Position{}
+}
+
+// --state-file
+var state State
+var stateLock sync.Mutex
+
+// grepFile searches a file, or stdin if name is '-'.
+func grepFile(pat string, rs string, name string, skipBinary bool, merge chan<- Merged) {
+    if name == "-" {
+        grepStream(pat, rs, "(standard input)", os.Stdin, *optDecompress, skipBinary, Position{}, merge)
+        return
+    }
+    file, e := os.Open(name)
+    if e != nil {
+        warn("%s", e)
+        return
+    }
+    defer file.Close()
+    head := make([]byte, len(magicXz))
+    file.ReadAt(head, 0)
+    if bytes.HasPrefix(head, magicZip) {
+        fi, e := file.Stat()
+        checkError(e)
+        grepZip(pat, rs, name, file, fi.Size(), merge)
+        return
+    }
+    var r io.Reader = file
+    start := Position{}
+    if state == nil && !seekStart.IsZero() && !isCompressed(head) && !*optNullData {
+        start.Offset = seekTime(file, rs, seekStart)
+    }
+    stateLock.Lock()
+    if state != nil {
+        start = state.resume(name, file)
+    }
+    stateLock.Unlock()
+    if start.Offset > 0 {
+        debug("%s: resume from %d\n", name, start.Offset)
+        if isCompressed(head) {
+            var dr io.ReadCloser
+            dr, e = decompress(file)
+            if e == nil {
+                defer dr.Close()
+                r = dr
+                _, e = io.CopyN(ioutil.Discard, r, start.Offset)
+            }
+        } else {
+            _, e = file.Seek(start.Offset, io.SeekStart)
+        }
+        if e != nil {
+            warn("%s: %s", name, e)
+            return
+        }
+    }
+    end := grepStream(pat, rs, name, r, true, skipBinary, start, merge)
+    stateLock.Lock()
+    if state != nil {
+        state.update(name, file, end)
+    }
+    stateLock.Unlock()
+}
+
 func main() {
     goopt.Description = func() string {
         return "Example program for using the goopt flag library."
@@ -357,7 +821,41 @@ func main() {
     //defer fmt.Print("\033[0m") // defer resetting the terminal to default colors
 
     debug("os.Args: %s\n", os.Args)
+    if *optTimestamp {
+        *rs = TIMESTAMP_REGEX
+    }
     debug("rs=%s\n", *rs)
+    if *optTimezone != "" {
+        loc, err := time.LoadLocation(*optTimezone)
+        checkError(err)
+        timeLocation = loc
+    }
+    if *optSince != "" {
+        t, err := parseTimeArg(*optSince)
+        checkError(err)
+        since = t
+    }
+    if *optUntil != "" {
+        t, err := parseTimeArg(*optUntil)
+        checkError(err)
+        until = t
+    }
+    if *optSeekTime != "" {
+        t, err := parseTimeArg(*optSeekTime)
+        checkError(err)
+        seekStart = t
+        if since.IsZero() || since.Before(t) {
+            since = t
+        }
+    }
+    if *optSeekEnd != "" {
+        t, err := parseTimeArg(*optSeekEnd)
+        checkError(err)
+        seekEnd = t
+        if until.IsZero() || until.After(t) {
+            until = t
+        }
+    }
 
     i := 0;
     for _, a := range goopt.Args[i:] {
@@ -365,10 +863,12 @@ func main() {
             i++
             break;
         }
-        // if an argument is a filename for existing one,
-        // assume that (and everything follows) as filename.
-        f, err := os.Stat(a)
-        if (err == nil && !f.IsDir() ) {
+        // if an argument other than the first is a filename for existing
+        // one, assume that (and everything follows) as filename. The
+        // first is a regex even if it happens to be a name like '.'.
+        // Directories are skipped with a warning unless -R, as grep does.
+        _, err := os.Stat(a)
+        if (i > 0 && (a == "-" || err == nil)) {
             break;
         }
         regex = append(regex, a)
@@ -384,12 +884,138 @@ func main() {
     }
     debug("regex: %s\n", regex)
     debug("files: %s\n", files)
+    if len(regex) == 0 {
+        fmt.Fprintln(os.Stderr, goopt.Usage())
+        os.Exit(1)
+    }
+    if groups := reComp(regex[0]).r.Groups(); *optOnlyGroup < 0 || *optOnlyGroup > groups {
+        checkError(fmt.Errorf("--only-group=%d: pattern has %d capture groups", *optOnlyGroup, groups))
+    }
 
+    if len(*optFollowGlob) > 0 {
+        *optFollow = true
+    }
+    if *optStateFile != "" && (*optFollow || *optRotated) {
+        // positions are of single files read from the beginning
+        checkError(errors.New("--state-file cannot be used with --follow or --rotated"))
+    }
+    if len(files) == 0 && !*optFollow {
+        if *optRecursive {
+            files = append(files, ".")
+        } else {
+            files = append(files, "-")
+        }
+    }
+    withFilename = len(files) > 1 || *optRecursive || len(*optFollowGlob) > 0
+    if *optFollow {
+        // followed files never end; search them concurrently
+        var wg sync.WaitGroup
+        for _, f := range files {
+            wg.Add(1)
+            go func(f string) {
+                defer wg.Done()
+                followFile(regex[0], *rs, f)
+            }(f)
+        }
+        for _, g := range *optFollowGlob {
+            wg.Add(1)
+            go func(g string) {
+                defer wg.Done()
+                followGlob(regex[0], *rs, g)
+            }(g)
+        }
+        wg.Wait()
+        return
+    }
+    if len(*optBaseline) > 0 {
+        baseline = NewBaseline(NewNormalizer(*optNormalize))
+        for _, f := range *optBaseline {
+            baseline.load(f, *rs)
+        }
+        if *optSaveBaseline != "" {
+            baseline.save(*optSaveBaseline)
+        }
+    }
+    if *optHistogram != "" {
+        width, err := time.ParseDuration(*optHistogram)
+        checkError(err)
+        if width <= 0 {
+            checkError(errors.New("--histogram needs a positive duration"))
+        }
+        aggregators = append(aggregators, NewHistogram(width, append([]string(nil), regex...)))
+        // records matching any of patterns are counted
+        regex[0] = anyPattern(regex)
+    }
+    if *optCountBy != "" {
+        aggregators = append(aggregators, NewCountBy(*optCountBy))
+    }
+    if *optStatsField != "" {
+        var width time.Duration
+        if *optStatsBucket != "" {
+            var err error
+            width, err = time.ParseDuration(*optStatsBucket)
+            checkError(err)
+        }
+        aggregators = append(aggregators, NewStats(*optStatsField, width))
+    }
+    if *optGaps != "" {
+        threshold, err := time.ParseDuration(*optGaps)
+        checkError(err)
+        aggregators = append(aggregators, NewGaps(threshold))
+    }
+    if *optUniq {
+        aggregators = append(aggregators, NewUniq(NewNormalizer(*optNormalize)))
+    }
+    if *optCluster {
+        aggregators = append(aggregators, NewClusters(NewNormalizer(*optNormalize),
+                                                  float64(*optClusterSimilarity) / 100))
+    }
+    if *optStateFile != "" {
+        state = loadState(*optStateFile)
+        defer state.save(*optStateFile)
+    }
+    // with --merge, files are collected first and searched concurrently
+    var names []string
+    var skip []bool
+    search := func(name string, skipBinary bool) {
+        if *optMerge {
+            names = append(names, name)
+            skip = append(skip, skipBinary)
+        } else {
+            grepInput(regex[0], *rs, name, skipBinary, nil)
+        }
+    }
+    seen := make(map[string]bool)
     for _, f := range files {
-        file, e := os.Open(f)
-        checkError(e)
-        defer file.Close()
-        mlrgrep_srf(regex[0], *rs, file)
+        if fi, err := os.Stat(f); f != "-" && err == nil && fi.IsDir() {
+            if !*optRecursive {
+                warn("%s: Is a directory", f)
+                continue
+            }
+            walk(f, seen, func(path string) {
+                if *optRotated && isRotated(path) {
+                    return // searched with the current file
+                }
+                search(path, *optBinaryFiles == "skip")
+            })
+            continue
+        }
+        search(f, false)
         //mlrgrep_fpf(regex[0], *rs, file)
     }
+    if *optMerge {
+        // set before files are searched concurrently
+        withFilename = true
+        merger := NewMerger(len(names))
+        for i := range names {
+            go func(i int) {
+                defer merger.done(i)
+                grepInput(regex[0], *rs, names[i], skip[i], merger.input(i))
+            }(i)
+        }
+        merger.run(bufio.NewWriterSize(os.Stdout, 65536))
+    }
+    for _, s := range aggregators {
+        s.print(bufio.NewWriterSize(os.Stdout, 65536))
+    }
 }
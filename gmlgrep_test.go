@@ -0,0 +1,127 @@
+package main
+
+import (
+    "bufio"
+    "reflect"
+    "strings"
+    "testing"
+    "testing/iotest"
+)
+
+// records splits input into records as grep_record() sees them
+func records(t *testing.T, rs string, input string, oneByte bool) []string {
+    var r = strings.NewReader(input)
+    var got []string
+    var err error
+    if oneByte {
+        // exercise requests for more data in the middle of RS lines
+        err = forEachRecord(rs, iotest.OneByteReader(r), func(text string) {
+            got = append(got, text)
+        })
+    } else {
+        err = forEachRecord(rs, r, func(text string) {
+            got = append(got, text)
+        })
+    }
+    if err != nil {
+        t.Fatal(err)
+    }
+    return got
+}
+
+func TestSplitRecords(t *testing.T) {
+    tests := []struct {
+        name  string
+        rs    string
+        input string
+        want  []string
+    }{
+        {"blank lines", RS_REGEX, "a\nb\n\nc\n\n\nd\n",
+         []string{"a\nb\n", "\nc\n", "\n", "\nd\n"}},
+        {"dashes", RS_REGEX, "a\n-----\nb\n=====\nc",
+         []string{"a\n", "-----\nb\n", "=====\nc"}},
+        {"starts with RS", RS_REGEX, "\na\n",
+         []string{"\na\n"}},
+        {"no RS", RS_REGEX, "a\nb\n",
+         []string{"a\nb\n"}},
+        {"empty", RS_REGEX, "",
+         nil},
+        {"timestamps", TIMESTAMP_REGEX,
+         "2026-10-01 10:00:00 x\n  y\n2026-10-01 10:00:01 z\n",
+         []string{"2026-10-01 10:00:00 x\n  y\n", "2026-10-01 10:00:01 z\n"}},
+        {"RS without newline at EOF", TIMESTAMP_REGEX,
+         "2026-10-01 10:00:00 x\n2026-10-01 10:00:01 z",
+         []string{"2026-10-01 10:00:00 x\n", "2026-10-01 10:00:01 z"}},
+        {"text before first RS", TIMESTAMP_REGEX,
+         "header\n2026-10-01 10:00:00 x\n",
+         []string{"header\n", "2026-10-01 10:00:00 x\n"}},
+    }
+    for _, tt := range tests {
+        for _, oneByte := range []bool{false, true} {
+            got := records(t, tt.rs, tt.input, oneByte)
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("%s (one byte reads: %v): got %q, want %q", tt.name, oneByte, got, tt.want)
+            }
+        }
+    }
+}
+
+func TestSplitRSSize(t *testing.T) {
+    s := NewSplitRecordFirstFinder("", TIMESTAMP_REGEX)
+    scanner := bufio.NewScanner(strings.NewReader("a\n2026-10-01 10:00:00 x\nb\n"))
+    scanner.Split(s.Split)
+    if !scanner.Scan() {
+        t.Fatal("no token")
+    }
+    // RS covers the rest of the line, but rsSize is of the match only
+    if got, want := scanner.Text(), "a\n2026-10-01 10:00:00 x\n"; got != want {
+        t.Errorf("token: got %q, want %q", got, want)
+    }
+    if s.rsPos != 2 || s.rsSize != len("2026-10-01 10:00:00") {
+        t.Errorf("rsPos, rsSize: got %d, %d", s.rsPos, s.rsSize)
+    }
+}
+
+func TestRecordJoiner(t *testing.T) {
+    var j RecordJoiner
+    // "x\n" before the first RS, then RS "2026-10-01 10:00:00" of 19 bytes
+    text, rsSize := j.join(Record{"x\n" + recA, 2, 19})
+    if text != "x\n" || rsSize != 0 {
+        t.Errorf("first: got %q %d", text, rsSize)
+    }
+    text, rsSize = j.join(Record{"  y\n" + recB, 4, 19})
+    if text != recA + "  y\n" || rsSize != 19 {
+        t.Errorf("second: got %q %d", text, rsSize)
+    }
+    text, rsSize = j.last()
+    if text != recB || rsSize != 19 {
+        t.Errorf("last: got %q %d", text, rsSize)
+    }
+    // an empty Record flushes RS held, e.g., with --follow
+    text, _ = j.join(Record{})
+    if text != recB {
+        t.Errorf("flush: got %q", text)
+    }
+    if text, _ = j.last(); text != "" {
+        t.Errorf("last after flush: got %q", text)
+    }
+}
+
+func TestOnlyMatchingSkipsEmpty(t *testing.T) {
+    *optOnlyMatching = true
+    defer func() { *optOnlyMatching = false }()
+    input := recA + recB + "  bb\n"
+    tests := []struct {
+        pat  string
+        want string
+    }{
+        {"b*", "2:2:b\n2:3:bb\n"},
+        {"^", ""},
+        {"a|b+", "1:1:a\n2:2:b\n2:3:bb\n"},
+    }
+    for _, tt := range tests {
+        if got, _ := grepString(tt.pat, input, Position{}); got != tt.want {
+            t.Errorf("-o %q: got %q, want %q", tt.pat, got, tt.want)
+        }
+    }
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// Histogram of selected records over time (--histogram)
+//
+// Selected records are counted per time bucket of their timestamps,
+// instead of being printed. Buckets without records between the first
+// and the last are shown as zero, so that a spike stands out. When
+// multiple patterns are given, records matching any of them are selected
+// and counted for each pattern they match.
+//
+// The histogram is an ASCII bar chart if stdout is a TTY, CSV otherwise,
+// or a JSON object per bucket with --output=jsonl.
+
+const HISTOGRAM_BAR_WIDTH = 50
+
+type Histogram struct {
+    width    time.Duration
+    patterns []string
+    res      []Regexp   // to count per pattern; nil if only one
+    lock     sync.Mutex
+    buckets  map[int64]*bucket // by start time in Unix nano
+    untimed  int               // records without timestamp
+}
+
+type bucket struct {
+    total int   // records matching any of patterns
+    per   []int // for each pattern, if multiple
+}
+
+// counts returns the numbers to show for the bucket
+func (b *bucket) counts() []int {
+    if b.per == nil {
+        return []int{b.total}
+    }
+    return b.per
+}
+
+func NewHistogram(width time.Duration, patterns []string) *Histogram {
+    h := &Histogram{width: width, patterns: patterns, buckets: make(map[int64]*bucket)}
+    if len(patterns) > 1 && !*optInvert {
+        for _, p := range patterns {
+            h.res = append(h.res, reComp(p))
+        }
+    }
+    return h
+}
+
+// anyPattern returns a regex to select records matching any of patterns
+func anyPattern(patterns []string) string {
+    if len(patterns) == 1 {
+        return patterns[0]
+    }
+    return "(?:" + strings.Join(patterns, ")|(?:") + ")"
+}
+
+func (h *Histogram) add(name string, e Entry) {
+    var hits []int
+    for i, re := range h.res {
+        if re.FindIndex(unsafeStrToByte(e.text)) != nil {
+            hits = append(hits, i)
+        }
+    }
+    h.lock.Lock()
+    defer h.lock.Unlock()
+    if e.ts.IsZero() {
+        h.untimed++
+        return
+    }
+    start := e.ts.Truncate(h.width).UnixNano()
+    b := h.buckets[start]
+    if b == nil {
+        b = h.newBucket()
+        h.buckets[start] = b
+    }
+    b.total++
+    for _, i := range hits {
+        b.per[i]++
+    }
+}
+
+func (h *Histogram) newBucket() *bucket {
+    b := new(bucket)
+    if h.res != nil {
+        b.per = make([]int, len(h.res))
+    }
+    return b
+}
+
+func isTerminal(f *os.File) bool {
+    fi, err := f.Stat()
+    return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+func (h *Histogram) print(w *bufio.Writer) {
+    defer w.Flush()
+    if h.untimed > 0 {
+        warn("%d records without timestamp are not in the histogram", h.untimed)
+    }
+    if len(h.buckets) == 0 {
+        return
+    }
+    var first, last int64
+    max := 0
+    for start, b := range h.buckets {
+        if first == 0 || start < first {
+            first = start
+        }
+        if start > last {
+            last = start
+        }
+        for _, n := range b.counts() {
+            if n > max {
+                max = n
+            }
+        }
+    }
+    series := len(h.res)
+    switch {
+    case *optOutput == "jsonl":
+    case isTerminal(os.Stdout):
+    default:
+        io.WriteString(w, "time")
+        if series == 0 {
+            io.WriteString(w, ",count")
+        }
+        for i := 0; i < series; i++ {
+            io.WriteString(w, "," + csvField(h.patterns[i]))
+        }
+        io.WriteString(w, "\n")
+    }
+    for start := first; start <= last; start += int64(h.width) {
+        t := time.Unix(0, start).In(timeLocation)
+        b := h.buckets[start]
+        if b == nil {
+            b = h.newBucket()
+        }
+        switch {
+        case *optOutput == "jsonl":
+            h.writeJSON(w, t, b)
+        case isTerminal(os.Stdout):
+            h.writeBars(w, t, b.counts(), max)
+        default:
+            io.WriteString(w, t.Format("2006-01-02 15:04:05"))
+            for _, n := range b.counts() {
+                io.WriteString(w, "," + strconv.Itoa(n))
+            }
+            io.WriteString(w, "\n")
+        }
+    }
+}
+
+func csvField(s string) string {
+    if strings.ContainsAny(s, ",\"\n") {
+        return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+    }
+    return s
+}
+
+// writeBars prints a line per pattern for a bucket, with time only on
+// the first one.
+func (h *Histogram) writeBars(w io.Writer, t time.Time, counts []int, max int) {
+    label := t.Format("2006-01-02 15:04:05")
+    for i, n := range counts {
+        bar := n * HISTOGRAM_BAR_WIDTH / max
+        if n > 0 && bar == 0 {
+            bar = 1
+        }
+        io.WriteString(w, label)
+        if len(counts) > 1 {
+            io.WriteString(w, fmt.Sprintf("  %-12.12s", h.patterns[i]))
+        }
+        io.WriteString(w, fmt.Sprintf(" %7d", n))
+        if bar > 0 {
+            io.WriteString(w, " " + strings.Repeat("#", bar))
+        }
+        io.WriteString(w, "\n")
+        label = strings.Repeat(" ", len(label))
+    }
+}
+
+type jsonBucket struct {
+    Time     time.Time      `json:"time"`
+    Count    int            `json:"count"`
+    Patterns map[string]int `json:"patterns,omitempty"`
+}
+
+// with multiple patterns, 'count' is of records matching any of them
+func (h *Histogram) writeJSON(w io.Writer, t time.Time, b *bucket) {
+    j := jsonBucket{Time: t, Count: b.total}
+    if b.per != nil {
+        j.Patterns = make(map[string]int)
+        for i, n := range b.per {
+            j.Patterns[h.patterns[i]] = n
+        }
+    }
+    data, err := json.Marshal(j)
+    checkError(err)
+    w.Write(append(data, '\n'))
+}
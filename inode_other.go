@@ -0,0 +1,12 @@
+//go:build !unix
+
+package main
+
+import (
+    "os"
+)
+
+// no inode; files are identified by fingerprint only
+func fileInode(fi os.FileInfo) uint64 {
+    return 0
+}
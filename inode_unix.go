@@ -0,0 +1,15 @@
+//go:build unix
+
+package main
+
+import (
+    "os"
+    "syscall"
+)
+
+func fileInode(fi os.FileInfo) uint64 {
+    if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+        return uint64(st.Ino)
+    }
+    return 0
+}
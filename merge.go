@@ -0,0 +1,92 @@
+package main
+
+import (
+    "bufio"
+    "container/heap"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// Chronological merge of multiple files (--merge)
+//
+// All inputs are searched concurrently. Instead of being printed,
+// records from each input are sent to its channel, and Merger prints
+// them in order of their timestamps (k-way merge), tagged with filename.
+// Records in an input are assumed to be in time order already.
+
+type Merged struct {
+    name    string
+    e       Entry
+    matched bool
+}
+
+type Merger struct {
+    inputs []chan Merged
+}
+
+func NewMerger(n int) *Merger {
+    m := new(Merger)
+    for i := 0; i < n; i++ {
+        m.inputs = append(m.inputs, make(chan Merged, 128))
+    }
+    return m
+}
+
+// input returns channel for records of i-th input, including members of
+// an archive.
+func (m *Merger) input(i int) chan<- Merged {
+    return m.inputs[i]
+}
+
+// done is called when i-th input has no more records
+func (m *Merger) done(i int) {
+    close(m.inputs[i])
+}
+
+type mergeItem struct {
+    Merged
+    src int
+}
+
+// mergeHeap implements heap.Interface, ordered by time and then by input
+type mergeHeap []mergeItem
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+    if !h[i].e.ts.Equal(h[j].e.ts) {
+        return h[i].e.ts.Before(h[j].e.ts)
+    }
+    return h[i].src < h[j].src
+}
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(mergeItem)) }
+func (h *mergeHeap) Pop() interface{} {
+    old := *h
+    x := old[len(old)-1]
+    *h = old[:len(old)-1]
+    return x
+}
+
+// run prints records from all inputs until all of them are done. Next
+// record to print is not known until every input has one, or is done.
+func (m *Merger) run(w *bufio.Writer) {
+    h := &mergeHeap{}
+    var delta Delta
+    next := func(src int) {
+        if rec, ok := <-m.inputs[src]; ok {
+            heap.Push(h, mergeItem{rec, src})
+        }
+    }
+    for i := range m.inputs {
+        next(i)
+    }
+    for h.Len() > 0 {
+        item := heap.Pop(h).(mergeItem)
+        note := ""
+        if *optDelta {
+            note = delta.prefix(item.e, item.matched)
+        }
+        writeAnnotated(w, item.name, item.e, item.matched, note)
+        next(item.src)
+    }
+    w.Flush()
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+    "encoding/json"
+    "io"
+    "strconv"
+    "strings"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// Record output
+//
+// Like grep(1), each output line can be prefixed with filename and its
+// location in the file, separated by ':' for selected records and '-'
+// for context records. Record number and byte offset are of the record
+// and same for all lines in it, whereas line number is of each line.
+//
+// With -o, only matched parts are printed, each on its own line and
+// always with record number and line number, so that it can be traced
+// back to the record it came from.
+//
+// With --output=jsonl, a JSON object is printed per selected record
+// instead, so that records with newlines can be consumed by other tools.
+//
+// With --null (or --null-data), every record, or every match with -o, is
+// terminated by NUL so that it can be passed to 'xargs -0' or 'sort -z'.
+
+func nullOutput() bool {
+    return *optNull || *optNullData
+}
+
+// terminator for output which doesn't end with newline (or NUL) by itself
+func recordTerminator() string {
+    if nullOutput() {
+        return "\x00"
+    }
+    return "\n"
+}
+
+func hasPrefix() bool {
+    return withFilename || *optLineNumber || *optRecordNumber || *optByteOffset
+}
+
+func writePrefix(w io.Writer, name string, num, line int, offset int64, sep string) {
+    if withFilename {
+        io.WriteString(w, name + sep)
+    }
+    if *optRecordNumber || *optOnlyMatching {
+        io.WriteString(w, strconv.Itoa(num) + sep)
+    }
+    if *optLineNumber || *optOnlyMatching {
+        io.WriteString(w, strconv.Itoa(line) + sep)
+    }
+    if *optByteOffset {
+        io.WriteString(w, strconv.FormatInt(offset, 10) + sep)
+    }
+}
+
+// -o; byte offset is of each match rather than the record
+func writeMatches(w io.Writer, name string, e Entry) {
+    for _, m := range e.matches {
+        line := e.line + strings.Count(e.text[:m[0]], "\n")
+        writePrefix(w, name, e.num, line, e.offset + int64(m[0]), ":")
+        io.WriteString(w, e.text[m[0]:m[1]])
+        if nullOutput() || e.text[m[1]-1] != '\n' {
+            io.WriteString(w, recordTerminator())
+        }
+    }
+}
+
+type jsonEntry struct {
+    File      string  `json:"file"`
+    Record    int     `json:"record"`
+    Line      int     `json:"line"`
+    Offset    int64   `json:"offset"`
+    Separator string  `json:"separator"`
+    Body      string  `json:"body"`
+    Matches   [][]int `json:"matches"` // [start, end) in separator+body
+}
+
+func writeJSON(w io.Writer, name string, e Entry) {
+    j := jsonEntry{
+        File:      name,
+        Record:    e.num,
+        Line:      e.line,
+        Offset:    e.offset,
+        Separator: e.text[:e.rsLen],
+        Body:      e.text[e.rsLen:],
+        Matches:   e.matches,
+    }
+    if j.Matches == nil {
+        j.Matches = [][]int{}
+    }
+    b, err := json.Marshal(j)
+    checkError(err)
+    w.Write(append(b, '\n'))
+}
+
+// writeEntry prints a record; 'matched' is false for context records.
+func writeEntry(w io.Writer, name string, e Entry, matched bool) {
+    writeAnnotated(w, name, e, matched, "")
+}
+
+// writeAnnotated prints a record like writeEntry, with 'note' before its
+// first non-empty line, i.e., after newlines of RS such as /^$/. It is
+// not printed with -o or --output=jsonl.
+func writeAnnotated(w io.Writer, name string, e Entry, matched bool, note string) {
+    if *optOutput == "jsonl" {
+        writeJSON(w, name, e)
+        return
+    }
+    if *optOnlyMatching {
+        writeMatches(w, name, e)
+        return
+    }
+    if nullOutput() && !strings.HasSuffix(e.text, "\x00") {
+        // the record itself is NUL terminated with --null-data
+        defer io.WriteString(w, "\x00")
+    }
+    if !hasPrefix() {
+        lead := len(e.text) - len(strings.TrimLeft(e.text, "\n"))
+        io.WriteString(w, e.text[:lead] + note + e.text[lead:])
+        return
+    }
+    sep := "-"
+    if matched {
+        sep = ":"
+    }
+    text := e.text
+    offset := e.offset
+    parts := e.parts
+    for line := e.line; text != ""; line++ {
+        if len(parts) > 0 && len(e.text) - len(text) >= parts[0].start {
+            // the rest of the record is in the next file of --rotated set
+            name, line, offset = parts[0].name, parts[0].line, parts[0].offset
+            parts = parts[1:]
+        }
+        eol := strings.IndexByte(text, '\n') + 1
+        if eol == 0 {
+            eol = len(text)
+        }
+        if note != "" && text[:eol] != "\n" {
+            io.WriteString(w, note)
+            note = ""
+        }
+        writePrefix(w, name, e.num, line, offset, sep)
+        io.WriteString(w, text[:eol])
+        text = text[eol:]
+    }
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "io"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// Rotated log sets (--rotated)
+//
+// FILE is expanded to FILE and its rotated siblings, e.g., 'app.log.1',
+// 'app.log.2.gz' (logrotate default) or 'app.log-20261016' (dateext),
+// which are read oldest-first as a single stream, so that a record split
+// across the rotation is found as one; a file without newline at its end
+// is terminated with one. Lines are labeled with the file they are in,
+// and line numbers and byte offsets are of that file. Record numbers
+// count through the whole set.
+
+var compressExts = []string{".gz", ".bz2", ".xz", ".zst"}
+
+type rotation struct {
+    path  string
+    dated string // date of dateext style suffix
+    num   int    // number of numbered suffix, or -1
+}
+
+// older reports whether a was rotated before b. Sets normally use either
+// suffix style; dated ones are taken older if mixed.
+func (a rotation) older(b rotation) bool {
+    if a.dated != "" && b.dated != "" {
+        return a.dated < b.dated
+    }
+    if a.dated != "" || b.dated != "" {
+        return a.dated != ""
+    }
+    return a.num > b.num
+}
+
+// parseRotation parses rotation suffix after 'base' in 'name', such as
+// '.2.gz' or '-20261016'.
+func parseRotation(base string, name string) (rotation, bool) {
+    r := rotation{num: -1}
+    if !strings.HasPrefix(name, base) {
+        return r, false
+    }
+    s := name[len(base):]
+    for _, ext := range compressExts {
+        s = strings.TrimSuffix(s, ext)
+    }
+    isDigits := func(s string) bool {
+        return s != "" && strings.Trim(s, "0123456789") == ""
+    }
+    switch {
+    case strings.HasPrefix(s, ".") && isDigits(s[1:]):
+        r.num, _ = strconv.Atoi(s[1:])
+        return r, true
+    case strings.HasPrefix(s, "-") && len(s) >= 9 && isDigits(strings.Replace(s[1:], "-", "", -1)):
+        // YYYYMMDD, possibly with hour or '-SEQ'
+        r.dated = s[1:]
+        return r, true
+    }
+    return r, false
+}
+
+// rotationSet returns existing files of the rotation set of 'name',
+// oldest first; 'name' itself is the newest.
+func rotationSet(name string) []string {
+    dir, base := filepath.Split(name)
+    d := dir
+    if d == "" {
+        d = "."
+    }
+    entries, err := os.ReadDir(d)
+    if err != nil {
+        warn("%s", err)
+        return nil
+    }
+    var set []rotation
+    current := false
+    for _, ent := range entries {
+        if ent.IsDir() {
+            continue
+        }
+        if ent.Name() == base {
+            current = true
+            continue
+        }
+        if r, ok := parseRotation(base, ent.Name()); ok {
+            r.path = filepath.Join(dir, ent.Name())
+            set = append(set, r)
+        }
+    }
+    sort.SliceStable(set, func(i, j int) bool { return set[i].older(set[j]) })
+    var paths []string
+    for _, r := range set {
+        paths = append(paths, r.path)
+    }
+    if current {
+        paths = append(paths, name)
+    }
+    return paths
+}
+
+// isRotated reports whether 'path' is a rotated file of another file in
+// the same directory, which is searched as part of that file's set.
+func isRotated(path string) bool {
+    for i := len(path) - 1; i > 0; i-- {
+        if path[i] != '.' && path[i] != '-' {
+            continue
+        }
+        if _, ok := parseRotation(path[:i], path); ok {
+            if fi, err := os.Stat(path[:i]); err == nil && fi.Mode().IsRegular() {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// Segment is where a file of the set begins in the stream
+type Segment struct {
+    name   string
+    offset int64
+    lines  int
+}
+
+// RotatedReader reads decompressed files of a rotation set one after
+// another.
+type RotatedReader struct {
+    names []string // files not opened yet
+    file  *os.File
+    r     io.ReadCloser // decompressed file
+    pos   int64
+    lines int
+    last  byte       // last byte read from the current file
+    lock  sync.Mutex // for segs; locate() is called while reading ahead
+    segs  []Segment
+}
+
+func NewRotatedReader(names []string) *RotatedReader {
+    return &RotatedReader{names: names}
+}
+
+func (rr *RotatedReader) Close() error {
+    if rr.file == nil {
+        return nil
+    }
+    rr.r.Close()
+    return rr.file.Close()
+}
+
+// next opens the next file of the set, skipping ones it failed to open
+func (rr *RotatedReader) next() bool {
+    for len(rr.names) > 0 {
+        name := rr.names[0]
+        rr.names = rr.names[1:]
+        file, err := os.Open(name)
+        if err != nil {
+            warn("%s", err)
+            continue
+        }
+        r, err := decompress(file)
+        if err != nil {
+            warn("%s: %s", name, err)
+            file.Close()
+            continue
+        }
+        rr.file, rr.r = file, r
+        rr.last = '\n'
+        rr.lock.Lock()
+        rr.segs = append(rr.segs, Segment{name, rr.pos, rr.lines})
+        rr.lock.Unlock()
+        return true
+    }
+    return false
+}
+
+func (rr *RotatedReader) Read(p []byte) (int, error) {
+    for {
+        if rr.r == nil && !rr.next() {
+            return 0, io.EOF
+        }
+        n, err := rr.r.Read(p)
+        if n > 0 {
+            rr.pos += int64(n)
+            rr.lines += bytes.Count(p[:n], []byte("\n"))
+            rr.last = p[n-1]
+            return n, nil
+        }
+        if err == io.EOF {
+            rr.Close()
+            rr.file, rr.r = nil, nil
+            if rr.last != '\n' && len(rr.names) > 0 && len(p) > 0 {
+                // the file has no newline at its end; terminate its last
+                // line, not to join it with the first line of next file
+                p[0] = '\n'
+                rr.last = '\n'
+                rr.pos++
+                rr.lines++
+                return 1, nil
+            }
+            continue
+        }
+        if err != nil {
+            return 0, err
+        }
+    }
+}
+
+// Part is where a record continues in a later file of the set
+type Part struct {
+    start  int // position in Entry.text
+    name   string
+    line   int
+    offset int64
+}
+
+// locate returns the file e begins in, and e with line number and byte
+// offset in that file, and parts in later files if it spans them.
+func (rr *RotatedReader) locate(e Entry) (string, Entry) {
+    rr.lock.Lock()
+    defer rr.lock.Unlock()
+    if len(rr.segs) == 0 {
+        return "", e
+    }
+    i := sort.Search(len(rr.segs), func(i int) bool { return rr.segs[i].offset > e.offset }) - 1
+    if i < 0 {
+        i = 0
+    }
+    seg := rr.segs[i]
+    end := e.offset + int64(len(e.text))
+    for _, next := range rr.segs[i+1:] {
+        if next.offset >= end {
+            break
+        }
+        e.parts = append(e.parts, Part{int(next.offset - e.offset), next.name, 1, 0})
+    }
+    e.offset -= seg.offset
+    e.line -= seg.lines
+    return seg.name, e
+}
+
+func grepRotated(pat string, rs string, name string, skipBinary bool, merge chan<- Merged) {
+    set := rotationSet(name)
+    if len(set) == 0 {
+        warn("%s: No such file or directory", name)
+        return
+    }
+    debug("rotated: %s\n", set)
+    if len(set) > 1 && !withFilename {
+        // already set with --merge, where files are searched concurrently
+        withFilename = true
+    }
+    if skipBinary && !*optNullData && rotatedBinary(set[len(set)-1]) {
+        debug("skip binary file %s\n", name)
+        return
+    }
+    rr := NewRotatedReader(set)
+    defer rr.Close()
+    mlrgrep_srf(pat, rs, name, rr, Position{}, merge)
+}
+
+// rotatedBinary checks the newest file of a set for --binary-files=skip
+func rotatedBinary(name string) bool {
+    file, err := os.Open(name)
+    if err != nil {
+        return false
+    }
+    defer file.Close()
+    r, err := decompress(file)
+    if err != nil {
+        return false
+    }
+    defer r.Close()
+    return isBinary(bufio.NewReader(r))
+}
+
+// grepInput searches a file given on the command line or found with -R
+func grepInput(pat string, rs string, name string, skipBinary bool, merge chan<- Merged) {
+    if *optRotated && name != "-" {
+        grepRotated(pat, rs, name, skipBinary, merge)
+    } else {
+        grepFile(pat, rs, name, skipBinary, merge)
+    }
+}
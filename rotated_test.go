@@ -0,0 +1,119 @@
+package main
+
+import (
+    "io/ioutil"
+    "path/filepath"
+    "reflect"
+    "testing"
+)
+
+func TestParseRotation(t *testing.T) {
+    tests := []struct {
+        name  string
+        ok    bool
+        num   int
+        dated string
+    }{
+        {"app.log.1", true, 1, ""},
+        {"app.log.12.gz", true, 12, ""},
+        {"app.log.3.zst", true, 3, ""},
+        {"app.log-20261016", true, -1, "20261016"},
+        {"app.log-20261016.gz", true, -1, "20261016"},
+        {"app.log-2026101612", true, -1, "2026101612"},
+        {"app.log-20261016-2", true, -1, "20261016-2"},
+        {"app.log", false, -1, ""},
+        {"app.log.gz", false, -1, ""},
+        {"app.log.old", false, -1, ""},
+        {"app.log-2026", false, -1, ""},
+        {"app.log.1.bak", false, -1, ""},
+        {"other.log.1", false, -1, ""},
+    }
+    for _, tt := range tests {
+        r, ok := parseRotation("app.log", tt.name)
+        if ok != tt.ok || r.num != tt.num || r.dated != tt.dated {
+            t.Errorf("%s: got %+v %v, want num %d dated %q %v", tt.name, r, ok, tt.num, tt.dated, tt.ok)
+        }
+    }
+}
+
+func TestRotationOlder(t *testing.T) {
+    r1 := rotation{num: 1}
+    r2 := rotation{num: 2}
+    d1 := rotation{num: -1, dated: "20261015"}
+    d2 := rotation{num: -1, dated: "20261016"}
+    tests := []struct {
+        a, b rotation
+        want bool
+    }{
+        {r2, r1, true},
+        {r1, r2, false},
+        {d1, d2, true},
+        {d2, d1, false},
+        {d2, r2, true}, // dated ones are older if mixed
+        {r2, d1, false},
+        {r1, r1, false},
+    }
+    for _, tt := range tests {
+        if got := tt.a.older(tt.b); got != tt.want {
+            t.Errorf("%+v older than %+v: got %v", tt.a, tt.b, got)
+        }
+    }
+}
+
+func TestLocate(t *testing.T) {
+    rr := &RotatedReader{segs: []Segment{
+        {"app.log.2", 0, 0},
+        {"app.log.1", 100, 5},
+        {"app.log", 150, 8},
+    }}
+    tests := []struct {
+        e      Entry
+        name   string
+        line   int
+        offset int64
+        parts  []Part
+    }{
+        {Entry{text: "x\n", line: 1, offset: 0}, "app.log.2", 1, 0, nil},
+        {Entry{text: "x\n", line: 3, offset: 40}, "app.log.2", 3, 40, nil},
+        {Entry{text: "x\n", line: 6, offset: 100}, "app.log.1", 1, 0, nil},
+        {Entry{text: "x\n", line: 10, offset: 160}, "app.log", 2, 10, nil},
+        // continues in the next file
+        {Entry{text: "x\ny\nz\n", line: 5, offset: 98}, "app.log.2", 5, 98,
+         []Part{{2, "app.log.1", 1, 0}}},
+        // spans all of the next file
+        {Entry{text: string(make([]byte, 60)), line: 5, offset: 98}, "app.log.2", 5, 98,
+         []Part{{2, "app.log.1", 1, 0}, {52, "app.log", 1, 0}}},
+    }
+    for _, tt := range tests {
+        name, e := rr.locate(tt.e)
+        if name != tt.name || e.line != tt.line || e.offset != tt.offset || !reflect.DeepEqual(e.parts, tt.parts) {
+            t.Errorf("line %d offset %d: got %s:%d:%d %v, want %s:%d:%d %v",
+                tt.e.line, tt.e.offset, name, e.line, e.offset, e.parts,
+                tt.name, tt.line, tt.offset, tt.parts)
+        }
+    }
+}
+
+func TestRotatedReaderTerminatesLines(t *testing.T) {
+    dir := t.TempDir()
+    old := "2026-10-01 09:00:00 old x"
+    writeFile(t, filepath.Join(dir, "app.log.1"), old)
+    writeFile(t, filepath.Join(dir, "app.log"), recA)
+    rr := NewRotatedReader(rotationSet(filepath.Join(dir, "app.log")))
+    defer rr.Close()
+    data, err := ioutil.ReadAll(rr)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if want := old + "\n" + recA; string(data) != want {
+        t.Errorf("got %q, want %q", data, want)
+    }
+    if rr.lines != 2 {
+        t.Errorf("lines: got %d, want 2", rr.lines)
+    }
+    // the newer record begins at the first line of its file
+    name, e := rr.locate(Entry{text: recA, line: 2, offset: int64(len(old) + 1)})
+    if filepath.Base(name) != "app.log" || e.line != 1 || e.offset != 0 || e.parts != nil {
+        t.Errorf("got %s:%d:%d %v", name, e.line, e.offset, e.parts)
+    }
+}
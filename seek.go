@@ -0,0 +1,78 @@
+package main
+
+import (
+    "bytes"
+    "os"
+    "time"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// Binary search of time-ordered files (--seek-time and --seek-end)
+//
+// Instead of reading from the beginning, the file is bisected by seeking
+// to byte offsets and re-syncing to the next record with a timestamp, to
+// find a record before and near the first one at or after --seek-time.
+// Records before --seek-time are then skipped like --since. Reading stops
+// at the first record at or after --seek-end.
+
+const SEEK_CHUNK = 64 * 1024
+
+var seekStart, seekEnd time.Time // zero if not given
+
+// recordAfter returns offset and time of the first record with timestamp
+// which begins after 'pos', or -1 if there is none within SEEK_CHUNK.
+func recordAfter(file *os.File, pos int64, rsFinder func(d []byte) (int, int)) (int64, time.Time) {
+    buf := make([]byte, SEEK_CHUNK)
+    n, _ := file.ReadAt(buf, pos)
+    buf = buf[:n]
+    i := 0
+    if pos > 0 {
+        i = bytes.IndexByte(buf, '\n') + 1 // skip partial line
+        if i == 0 {
+            return -1, time.Time{}
+        }
+    }
+    for i < len(buf) {
+        p, sz := rsFinder(buf[i:])
+        if p < 0 {
+            break
+        }
+        begin := i + p
+        head := buf[begin:]
+        if len(head) > 4096 {
+            head = head[:4096]
+        }
+        if ts, ok := recordTime(string(head)); ok {
+            return pos + int64(begin), ts
+        }
+        // RS without timestamp; try next one
+        eol := bytes.IndexByte(buf[begin+sz:], '\n')
+        if eol < 0 {
+            break
+        }
+        i = begin + sz + eol + 1
+    }
+    return -1, time.Time{}
+}
+
+// seekTime returns offset of a record at or before the first record with
+// timestamp at or after t.
+func seekTime(file *os.File, rs string, t time.Time) int64 {
+    fi, err := file.Stat()
+    if err != nil {
+        return 0
+    }
+    rsFinder := regexFinder(rs)
+    lo, hi := int64(0), fi.Size()
+    for hi - lo > SEEK_CHUNK {
+        mid := lo + (hi - lo) / 2
+        off, ts := recordAfter(file, mid, rsFinder)
+        if off < 0 || !ts.Before(t) {
+            hi = mid
+        } else {
+            lo = off
+        }
+    }
+    debug("seek to %d for %s\n", lo, t)
+    return lo
+}
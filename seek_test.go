@@ -0,0 +1,84 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+// writeTimedLog writes n records a second apart from 'begin', and returns
+// the file and offsets of the records.
+func writeTimedLog(t *testing.T, begin time.Time, n int) (*os.File, []int64) {
+    var b strings.Builder
+    offsets := make([]int64, n)
+    for i := 0; i < n; i++ {
+        offsets[i] = int64(b.Len())
+        ts := begin.Add(time.Duration(i) * time.Second)
+        fmt.Fprintf(&b, "%s record %d\n", ts.Format("2006-01-02 15:04:05"), i)
+        if i % 3 == 0 {
+            b.WriteString("  continued line\n")
+        }
+    }
+    path := filepath.Join(t.TempDir(), "app.log")
+    if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+        t.Fatal(err)
+    }
+    file, err := os.Open(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { file.Close() })
+    return file, offsets
+}
+
+func TestSeekTime(t *testing.T) {
+    begin := time.Date(2026, 10, 1, 0, 0, 0, 0, time.Local)
+    n := 20000 // over a few SEEK_CHUNK
+    file, offsets := writeTimedLog(t, begin, n)
+
+    for _, i := range []int{0, 1, 1000, n / 2, n - 1} {
+        target := begin.Add(time.Duration(i) * time.Second)
+        off := seekTime(file, TIMESTAMP_REGEX, target)
+        if off > offsets[i] {
+            t.Errorf("record %d: seek to %d, past the record at %d", i, off, offsets[i])
+        }
+        if offsets[i] - off > 2 * SEEK_CHUNK {
+            t.Errorf("record %d: seek to %d, far before the record at %d", i, off, offsets[i])
+        }
+        found := false
+        for _, o := range offsets {
+            if o == off {
+                found = true
+                break
+            }
+        }
+        if !found {
+            t.Errorf("record %d: seek to %d, not at a record", i, off)
+        }
+    }
+
+    if off := seekTime(file, TIMESTAMP_REGEX, begin.Add(-time.Hour)); off != 0 {
+        t.Errorf("before all records: got %d, want 0", off)
+    }
+    if off := seekTime(file, TIMESTAMP_REGEX, begin.Add(time.Duration(n) * time.Hour)); off > offsets[n-1] {
+        t.Errorf("after all records: got %d, past the last record at %d", off, offsets[n-1])
+    }
+}
+
+func TestRecordAfter(t *testing.T) {
+    begin := time.Date(2026, 10, 1, 0, 0, 0, 0, time.Local)
+    file, offsets := writeTimedLog(t, begin, 10)
+    finder := regexFinder(TIMESTAMP_REGEX)
+
+    // from the middle of the first record, to the beginning of the second
+    off, ts := recordAfter(file, 3, finder)
+    if off != offsets[1] || !ts.Equal(begin.Add(time.Second)) {
+        t.Errorf("got %d %s, want %d %s", off, ts, offsets[1], begin.Add(time.Second))
+    }
+    if off, _ := recordAfter(file, offsets[9] + 1, finder); off != -1 {
+        t.Errorf("after the last record: got %d, want -1", off)
+    }
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+    "crypto/sha1"
+    "encoding/hex"
+    "encoding/json"
+    "io"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// Incremental scanning (--state-file)
+//
+// For each file, the state file records the position after the last
+// complete record processed, i.e., one followed by RS. Next run resumes
+// from there if the file is still the same one, which is identified by
+// inode and a fingerprint of its first bytes. A file renamed by log
+// rotation is found by them under its new name, too. Truncated or
+// replaced files are searched from the beginning.
+//
+// Renamed or compressed files are not expected to grow, so the last
+// record in them is processed even if it is not followed by RS.
+
+const FINGERPRINT_SIZE = 1024
+
+type FileState struct {
+    Inode          uint64
+    Fingerprint    string // SHA1 of first FingerprintLen bytes, hex encoded
+    FingerprintLen int
+    Position
+}
+
+type State map[string]*FileState
+
+// incomplete reports whether the last Record at EOF may be still being
+// written, i.e., not terminated by RS (or NUL with --null-data).
+func incomplete(rec *Record) bool {
+    if *optNullData {
+        return !strings.HasSuffix(rec.chunk, "\x00")
+    }
+    return rec.rsPos == len(rec.chunk)
+}
+
+func loadState(path string) State {
+    s := make(State)
+    data, err := ioutil.ReadFile(path)
+    if os.IsNotExist(err) {
+        return s
+    }
+    checkError(err)
+    checkError(json.Unmarshal(data, &s))
+    return s
+}
+
+// save writes the state to a temporary file first, so that the state is
+// not lost if interrupted.
+func (s State) save(path string) {
+    data, err := json.MarshalIndent(s, "", "  ")
+    checkError(err)
+    tmp, err := ioutil.TempFile(filepath.Dir(path), ".gmlgrep-state")
+    checkError(err)
+    _, err = tmp.Write(append(data, '\n'))
+    if err == nil {
+        err = tmp.Close()
+    }
+    if err == nil {
+        err = os.Rename(tmp.Name(), path)
+    }
+    if err != nil {
+        os.Remove(tmp.Name())
+    }
+    checkError(err)
+}
+
+func fingerprint(file *os.File, n int) string {
+    h := sha1.New()
+    io.Copy(h, io.NewSectionReader(file, 0, int64(n)))
+    return hex.EncodeToString(h.Sum(nil))
+}
+
+func (s State) valid(fs *FileState, file *os.File, inode uint64, size int64) bool {
+    return fs.Inode == inode && fs.Offset <= size &&
+           fs.Fingerprint == fingerprint(file, fs.FingerprintLen)
+}
+
+// resume returns the position to start reading the file from
+func (s State) resume(name string, file *os.File) Position {
+    fi, err := file.Stat()
+    if err != nil {
+        return Position{}
+    }
+    inode := fileInode(fi)
+    size := fi.Size()
+    head := make([]byte, len(magicXz))
+    file.ReadAt(head, 0)
+    growing := !isCompressed(head)
+    if !growing {
+        size = int64(^uint64(0) >> 1) // Offset is of decompressed data
+    }
+    if fs, ok := s[name]; ok && s.valid(fs, file, inode, size) {
+        pos := fs.Position
+        pos.Growing = growing
+        return pos
+    }
+    for other, fs := range s {
+        if other != name && s.valid(fs, file, inode, size) {
+            debug("%s: resume as renamed from %s\n", name, other)
+            return fs.Position
+        }
+    }
+    return Position{Growing: growing}
+}
+
+func (s State) update(name string, file *os.File, pos Position) {
+    fi, err := file.Stat()
+    if err != nil {
+        return
+    }
+    n := FINGERPRINT_SIZE
+    if fi.Size() < int64(n) {
+        n = int(fi.Size())
+    }
+    s[name] = &FileState{
+        Inode:          fileInode(fi),
+        Fingerprint:    fingerprint(file, n),
+        FingerprintLen: n,
+        Position:       pos,
+    }
+}
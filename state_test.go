@@ -0,0 +1,176 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+const (
+    recA = "2026-10-01 10:00:00 a\n"
+    recB = "2026-10-01 10:00:01 b\n"
+    recC = "2026-10-01 10:00:02 c\n"
+)
+
+// grepString runs grep_record over input as if it begins at 'start' of a
+// file, and returns what is printed and the position after it.
+func grepString(pat string, input string, start Position) (string, Position) {
+    return grepContext(pat, input, start, 0, 0)
+}
+
+// grepContext is grepString with -B 'before' and -A 'after'
+func grepContext(pat string, input string, start Position, before, after int) (string, Position) {
+    var buf bytes.Buffer
+    w := bufio.NewWriter(&buf)
+    out := NewContextPrinter(w, "test", before, after)
+    pipe := make(chan Record)
+    splitter := NewSplitRecordFirstFinder(pat, TIMESTAMP_REGEX)
+    scanner := bufio.NewScanner(strings.NewReader(input))
+    scanner.Split(splitter.Split)
+    go func() {
+        for scanner.Scan() {
+            pipe <- Record{scanner.Text(), splitter.rsPos, splitter.rsSize}
+        }
+        close(pipe)
+    }()
+    _, end := grep_record(pat, pipe, out, start)
+    w.Flush()
+    return buf.String(), end
+}
+
+func TestGrowingHoldsLastRecord(t *testing.T) {
+    got, end := grepString("^", recA + recB, Position{Growing: true})
+    if got != recA {
+        t.Errorf("got %q, want only %q", got, recA)
+    }
+    want := Position{Offset: int64(len(recA)), Lines: 1, Records: 1}
+    if end != want {
+        t.Errorf("end: got %+v, want %+v", end, want)
+    }
+
+    // next run after the last record got more lines and next record
+    rest := recB + "  more\n" + recC
+    end.Growing = true
+    got, end = grepString("^", rest, end)
+    if got != recB + "  more\n" {
+        t.Errorf("resumed: got %q", got)
+    }
+    want = Position{Offset: int64(len(recA + recB + "  more\n")), Lines: 3, Records: 2}
+    if end != want {
+        t.Errorf("resumed end: got %+v, want %+v", end, want)
+    }
+
+    // not growing, e.g., rotated; the last record is processed
+    got, _ = grepString("^", recC, end)
+    if got != recC {
+        t.Errorf("not growing: got %q, want %q", got, recC)
+    }
+}
+
+func TestIncomplete(t *testing.T) {
+    if !incomplete(&Record{chunk: "2026-10-01 10:00:00 a", rsPos: len("2026-10-01 10:00:00 a")}) {
+        t.Errorf("record without RS is complete")
+    }
+    if incomplete(&Record{chunk: "x\n" + recA, rsPos: 2}) {
+        t.Errorf("record followed by RS is incomplete")
+    }
+}
+
+func writeFile(t *testing.T, path string, data string) {
+    if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func appendFile(t *testing.T, path string, data string) {
+    f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer f.Close()
+    if _, err := f.WriteString(data); err != nil {
+        t.Fatal(err)
+    }
+}
+
+// resumeFrom opens path and returns where state s resumes it
+func resumeFrom(t *testing.T, s State, name string, path string) Position {
+    f, err := os.Open(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer f.Close()
+    return s.resume(name, f)
+}
+
+// recordState updates s as if path was read up to pos
+func recordState(t *testing.T, s State, path string, pos Position) {
+    f, err := os.Open(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer f.Close()
+    s.update(path, f, pos)
+}
+
+func TestStateResume(t *testing.T) {
+    dir := t.TempDir()
+    path := filepath.Join(dir, "app.log")
+    read := Position{Offset: int64(len(recA)), Lines: 1, Records: 1}
+
+    // appended
+    writeFile(t, path, recA + recB)
+    s := make(State)
+    recordState(t, s, path, read)
+    appendFile(t, path, recC)
+    want := read
+    want.Growing = true
+    if got := resumeFrom(t, s, path, path); got != want {
+        t.Errorf("after append: got %+v, want %+v", got, want)
+    }
+
+    // truncated, e.g., copytruncate
+    writeFile(t, path, "")
+    if got := resumeFrom(t, s, path, path); got != (Position{Growing: true}) {
+        t.Errorf("after truncation: got %+v, want from the beginning", got)
+    }
+
+    // rewritten with other content of the same size
+    writeFile(t, path, recA + recB)
+    recordState(t, s, path, read)
+    writeFile(t, path, recC + recB)
+    if got := resumeFrom(t, s, path, path); got != (Position{Growing: true}) {
+        t.Errorf("after rewrite: got %+v, want from the beginning", got)
+    }
+
+    // renamed by rotation; found under the new name, and not growing
+    writeFile(t, path, recA + recB)
+    recordState(t, s, path, read)
+    rotated := path + ".1"
+    if err := os.Rename(path, rotated); err != nil {
+        t.Fatal(err)
+    }
+    if got := resumeFrom(t, s, rotated, rotated); got != read {
+        t.Errorf("after rename: got %+v, want %+v", got, read)
+    }
+}
+
+func TestStateSaveLoad(t *testing.T) {
+    dir := t.TempDir()
+    path := filepath.Join(dir, "app.log")
+    writeFile(t, path, recA)
+    s := make(State)
+    recordState(t, s, path, Position{Offset: 3, Lines: 2, Records: 1, Growing: true})
+    statePath := filepath.Join(dir, "state.json")
+    s.save(statePath)
+    loaded := loadState(statePath)
+    // Growing is decided on resume, not saved
+    s[path].Growing = false
+    if !reflect.DeepEqual(loaded, s) {
+        t.Errorf("loaded %+v, want %+v", loaded[path], s[path])
+    }
+}
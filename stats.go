@@ -0,0 +1,133 @@
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "io"
+    "math"
+    "sort"
+    "strconv"
+    "sync"
+    "time"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// Statistics of a numeric field in selected records (--stats-field)
+//
+// The number in a record is what the first capture group of the regex
+// (or whole match) matches first in it. Count, min, max, mean and
+// percentiles are printed for all records, and for each time bucket with
+// --stats-bucket. Records without a number are only counted.
+
+type Stats struct {
+    re      Regexp
+    group   int
+    width   time.Duration // of time buckets; 0 if not per bucket
+    lock    sync.Mutex
+    all     []float64
+    buckets map[int64][]float64 // by start time in Unix nano
+    missing int                 // records without a number
+}
+
+func NewStats(pat string, width time.Duration) *Stats {
+    s := &Stats{re: reComp(pat), width: width, buckets: make(map[int64][]float64)}
+    if s.re.r.Groups() > 0 {
+        s.group = 1
+    }
+    return s
+}
+
+func (s *Stats) add(name string, e Entry) {
+    var v float64
+    ok := false
+    if locs := s.re.FindAllIndex(unsafeStrToByte(e.text), s.group); len(locs) > 0 {
+        var err error
+        v, err = strconv.ParseFloat(e.text[locs[0][0]:locs[0][1]], 64)
+        ok = err == nil
+    }
+    s.lock.Lock()
+    defer s.lock.Unlock()
+    if !ok {
+        s.missing++
+        return
+    }
+    s.all = append(s.all, v)
+    if s.width > 0 && !e.ts.IsZero() {
+        start := e.ts.Truncate(s.width).UnixNano()
+        s.buckets[start] = append(s.buckets[start], v)
+    }
+}
+
+type summary struct {
+    Time        *time.Time `json:"time,omitempty"`
+    Count       int        `json:"count"`
+    Min         float64    `json:"min"`
+    Max         float64    `json:"max"`
+    Mean        float64    `json:"mean"`
+    P50         float64    `json:"p50"`
+    P90         float64    `json:"p90"`
+    P99         float64    `json:"p99"`
+    Missing     *int       `json:"no_value,omitempty"` // only for all records
+}
+
+// percentile of sorted values, by nearest-rank method
+func percentile(values []float64, p float64) float64 {
+    return values[int(math.Ceil(p / 100 * float64(len(values)))) - 1]
+}
+
+// summarize sorts values
+func summarize(values []float64) summary {
+    sort.Float64s(values)
+    s := summary{Count: len(values), Min: values[0], Max: values[len(values)-1]}
+    sum := 0.0
+    for _, v := range values {
+        sum += v
+    }
+    s.Mean = sum / float64(len(values))
+    s.P50, s.P90, s.P99 = percentile(values, 50), percentile(values, 90), percentile(values, 99)
+    return s
+}
+
+func (s *Stats) writeRow(w io.Writer, label string, sum summary) {
+    if *optOutput == "jsonl" {
+        b, err := json.Marshal(sum)
+        checkError(err)
+        w.Write(append(b, '\n'))
+        return
+    }
+    if sum.Count == 0 {
+        io.WriteString(w, fmt.Sprintf("%-19s %8d\n", label, 0))
+        return
+    }
+    io.WriteString(w, fmt.Sprintf("%-19s %8d %10.6g %10.6g %10.6g %10.6g %10.6g %10.6g\n", label,
+                                  sum.Count, sum.Min, sum.Max, sum.Mean, sum.P50, sum.P90, sum.P99))
+}
+
+func (s *Stats) print(w *bufio.Writer) {
+    defer w.Flush()
+    if *optOutput != "jsonl" {
+        io.WriteString(w, fmt.Sprintf("%-19s %8s %10s %10s %10s %10s %10s %10s\n", "",
+                                      "count", "min", "max", "mean", "p50", "p90", "p99"))
+    }
+    all := summary{}
+    if len(s.all) > 0 {
+        all = summarize(s.all)
+    }
+    all.Missing = &s.missing
+    s.writeRow(w, "all", all)
+    starts := make([]int64, 0, len(s.buckets))
+    for start := range s.buckets {
+        starts = append(starts, start)
+    }
+    sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+    for _, start := range starts {
+        t := time.Unix(0, start).In(timeLocation)
+        sum := summarize(s.buckets[start])
+        sum.Time = &t
+        s.writeRow(w, t.Format("2006-01-02 15:04:05"), sum)
+    }
+    if *optOutput != "jsonl" {
+        io.WriteString(w, fmt.Sprintf("%-19s %8d\n", "no value", s.missing))
+    }
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+    "bytes"
+    "errors"
+    "strings"
+    "time"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// Record timestamps
+//
+// A record's time is taken from a timestamp at the beginning of its first
+// non-empty line, i.e., what TIMESTAMP_REGEX matches when used as RS, or
+// what --time-format describes. Timestamps without timezone are in
+// --timezone, or local time.
+
+var timestampRe = reComp(TIMESTAMP_REGEX)
+
+// timezone for timestamps without one
+var timeLocation = time.Local
+
+// Layouts tried in order against a timestamp matched by TIMESTAMP_REGEX,
+// after ' ' between date and time is replaced with 'T' and ',' before
+// fractional seconds with '.'. Go accepts fractional seconds after seconds
+// field even when the layout does not have them.
+var timestampLayouts = []string{
+    "2006-01-02T15:04:05Z07:00",
+    "2006-01-02T15:04:05Z0700",
+    "2006-01-02T15:04:05",
+    time.Stamp,
+}
+
+func parseTimestamp(s string) (time.Time, bool) {
+    if len(s) > 10 && s[10] == ' ' {
+        s = s[:10] + "T" + s[11:]
+    }
+    s = strings.Replace(s, ",", ".", 1)
+    for _, layout := range timestampLayouts {
+        t, err := time.ParseInLocation(layout, s, timeLocation)
+        if err != nil {
+            continue
+        }
+        if layout == time.Stamp {
+            // syslog style timestamps have no year
+            t = t.AddDate(time.Now().In(timeLocation).Year(), 0, 0)
+        }
+        return t, true
+    }
+    return time.Time{}, false
+}
+
+// parseWithFormat parses the beginning of line with --time-format. As
+// time.Parse() doesn't allow extra text after the timestamp, the line is
+// cut to the same number of space separated fields as the layout.
+func parseWithFormat(line string) (time.Time, bool) {
+    layout := strings.Fields(*optTimeFormat)
+    fields := strings.Fields(line)
+    if len(fields) < len(layout) {
+        return time.Time{}, false
+    }
+    t, err := time.ParseInLocation(strings.Join(layout, " "),
+                                   strings.Join(fields[:len(layout)], " "),
+                                   timeLocation)
+    if err != nil {
+        return time.Time{}, false
+    }
+    if t.Year() == 0 {
+        t = t.AddDate(time.Now().In(timeLocation).Year(), 0, 0)
+    }
+    return t, true
+}
+
+// recordTime returns timestamp at the beginning of the record, if any.
+func recordTime(rec string) (time.Time, bool) {
+    b := bytes.TrimLeft(unsafeStrToByte(rec), "\n")
+    if eol := bytes.IndexByte(b, '\n'); eol >= 0 {
+        b = b[:eol]
+    }
+    if *optTimeFormat != "" {
+        return parseWithFormat(string(b))
+    }
+    m := timestampRe.FindIndex(b)
+    if m == nil || m[0] != 0 {
+        return time.Time{}, false
+    }
+    return parseTimestamp(string(b[m[0]:m[1]]))
+}
+
+//////////////////////////////////////////////////////////////////////////////
+// Time range (--since and --until)
+
+var since, until time.Time // zero if not given
+
+// parseTimeArg parses time given on the command line; a duration relative
+// to now (e.g., '-15m'), a timestamp in one of the formats recognized in
+// records, date and time without seconds, a date, or time of today.
+func parseTimeArg(s string) (time.Time, error) {
+    now := time.Now().In(timeLocation)
+    if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+        d, err := time.ParseDuration(s)
+        return now.Add(d), err
+    }
+    if t, ok := parseTimestamp(s); ok {
+        return t, nil
+    }
+    if *optTimeFormat != "" {
+        if t, ok := parseWithFormat(s); ok {
+            return t, nil
+        }
+    }
+    for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02"} {
+        if t, err := time.ParseInLocation(layout, s, timeLocation); err == nil {
+            return t, nil
+        }
+    }
+    for _, layout := range []string{"15:04:05", "15:04"} {
+        if t, err := time.ParseInLocation(layout, s, timeLocation); err == nil {
+            y, m, d := now.Date()
+            return t.AddDate(y, int(m)-1, d-1), nil
+        }
+    }
+    return time.Time{}, errors.New("cannot parse time: " + s)
+}
+
+func timeFilter() bool {
+    return !since.IsZero() || !until.IsZero()
+}
+
+// inTimeRange reports whether the record is in --since and --until range.
+// Records without timestamp are out of range.
+func inTimeRange(e Entry) bool {
+    if e.ts.IsZero() {
+        return false
+    }
+    return (since.IsZero() || !e.ts.Before(since)) &&
+           (until.IsZero() || e.ts.Before(until))
+}
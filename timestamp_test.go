@@ -0,0 +1,81 @@
+package main
+
+import (
+    "testing"
+    "time"
+)
+
+func inUTC(t *testing.T) {
+    saved := timeLocation
+    timeLocation = time.UTC
+    t.Cleanup(func() { timeLocation = saved })
+}
+
+func TestParseTimestamp(t *testing.T) {
+    inUTC(t)
+    year := time.Now().In(time.UTC).Year()
+    tests := []struct {
+        in   string
+        want time.Time
+    }{
+        {"2026-10-01 10:00:01", time.Date(2026, 10, 1, 10, 0, 1, 0, time.UTC)},
+        {"2026-10-01T10:00:01Z", time.Date(2026, 10, 1, 10, 0, 1, 0, time.UTC)},
+        {"2026-10-01 10:00:01,250", time.Date(2026, 10, 1, 10, 0, 1, 250e6, time.UTC)},
+        {"2026-10-01T10:00:01.5+09:00", time.Date(2026, 10, 1, 1, 0, 1, 500e6, time.UTC)},
+        {"2026-10-01T10:00:01-0130", time.Date(2026, 10, 1, 11, 30, 1, 0, time.UTC)},
+        {"Oct  1 10:00:01", time.Date(year, 10, 1, 10, 0, 1, 0, time.UTC)},
+    }
+    for _, tt := range tests {
+        got, ok := parseTimestamp(tt.in)
+        if !ok || !got.Equal(tt.want) {
+            t.Errorf("parseTimestamp(%q) = %v, %v; want %v", tt.in, got, ok, tt.want)
+        }
+    }
+    if _, ok := parseTimestamp("10/01/2026"); ok {
+        t.Errorf("parseTimestamp accepted an unknown format")
+    }
+}
+
+func TestRecordTime(t *testing.T) {
+    inUTC(t)
+    want := time.Date(2026, 10, 1, 10, 0, 1, 0, time.UTC)
+    if got, ok := recordTime("\n2026-10-01 10:00:01 msg\nnext"); !ok || !got.Equal(want) {
+        t.Errorf("recordTime after blank line = %v, %v", got, ok)
+    }
+    if _, ok := recordTime("msg 2026-10-01 10:00:01\n"); ok {
+        t.Errorf("recordTime took a timestamp not at the beginning")
+    }
+}
+
+func TestParseTimeArg(t *testing.T) {
+    inUTC(t)
+    now := time.Now().In(time.UTC)
+    y, m, d := now.Date()
+    tests := []struct {
+        in   string
+        want time.Time
+    }{
+        {"2026-10-01 12:34:56", time.Date(2026, 10, 1, 12, 34, 56, 0, time.UTC)},
+        {"2026-10-01 12:34", time.Date(2026, 10, 1, 12, 34, 0, 0, time.UTC)},
+        {"2026-10-01T12:34", time.Date(2026, 10, 1, 12, 34, 0, 0, time.UTC)},
+        {"2026-10-01", time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)},
+        {"12:34", time.Date(y, m, d, 12, 34, 0, 0, time.UTC)},
+        {"12:34:56", time.Date(y, m, d, 12, 34, 56, 0, time.UTC)},
+    }
+    for _, tt := range tests {
+        got, err := parseTimeArg(tt.in)
+        if err != nil || !got.Equal(tt.want) {
+            t.Errorf("parseTimeArg(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+        }
+    }
+
+    got, err := parseTimeArg("-15m")
+    if diff := now.Add(-15 * time.Minute).Sub(got); err != nil || diff < -time.Second || diff > time.Second {
+        t.Errorf("parseTimeArg(\"-15m\") = %v, %v; want about %v", got, err, now.Add(-15 * time.Minute))
+    }
+    for _, bad := range []string{"yesterday", "2026-13-01", "-15x"} {
+        if _, err := parseTimeArg(bad); err == nil {
+            t.Errorf("parseTimeArg(%q) succeeded", bad)
+        }
+    }
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "fmt"
+    "io"
+    "strings"
+    "sync"
+    "time"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// Collapsing duplicate records (--uniq)
+//
+// Selected records are compared after normalization, so that records
+// differing only in timestamps, IDs or addresses are counted as one.
+// Each distinct record is printed once, in order of first appearance,
+// as it was first seen and with the number of times and where it was seen.
+
+// Normalizations by name for --normalize, applied in this order.
+// Timestamps are stripped at the beginning of each line with separators
+// following them, and others are masked with a placeholder.
+var normalizers = []struct {
+    name string
+    re   string
+    repl string
+}{
+    {"ts", TIMESTAMP_REGEX + `[ \t|:,-]*`, ""},
+    {"uuid", `\b[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}\b`, "<UUID>"},
+    // with 0x, or both digits and letters not to mask words like 'face'
+    {"hex", `\b(0[xX][0-9a-fA-F]+|[0-9a-fA-F]*([0-9][a-fA-F]|[a-fA-F][0-9])[0-9a-fA-F]*)\b`, "<HEX>"},
+    {"num", `\d+`, "<N>"},
+}
+
+type Normalizer struct {
+    res   []Regexp
+    repls []string
+}
+
+// NewNormalizer takes comma separated names of normalizers, or 'none'
+func NewNormalizer(list string) *Normalizer {
+    n := new(Normalizer)
+    names := strings.Split(list, ",")
+    for _, name := range names {
+        found := name == "none"
+        for _, nz := range normalizers {
+            found = found || nz.name == name
+        }
+        if !found {
+            checkError(fmt.Errorf("unknown normalization: %s", name))
+        }
+    }
+    for _, nz := range normalizers {
+        for _, name := range names {
+            if name == nz.name {
+                n.res = append(n.res, reComp(nz.re))
+                n.repls = append(n.repls, nz.repl)
+            }
+        }
+    }
+    return n
+}
+
+func (n *Normalizer) normalize(text string) string {
+    // leading RS is empty for the first record of a file
+    text = strings.Trim(text, "\n")
+    for i, re := range n.res {
+        text = re.ReplaceAll(unsafeStrToByte(text), n.repls[i])
+    }
+    return text
+}
+
+// Seen is where a record was found
+type Seen struct {
+    name string
+    e    Entry
+}
+
+type uniqRecord struct {
+    count       int
+    first, last Seen
+}
+
+type Uniq struct {
+    norm    *Normalizer
+    lock    sync.Mutex
+    records map[string]*uniqRecord
+    order   []string
+}
+
+func NewUniq(norm *Normalizer) *Uniq {
+    return &Uniq{norm: norm, records: make(map[string]*uniqRecord)}
+}
+
+func (u *Uniq) add(name string, e Entry) {
+    key := u.norm.normalize(e.text)
+    u.lock.Lock()
+    defer u.lock.Unlock()
+    r := u.records[key]
+    if r == nil {
+        r = &uniqRecord{first: Seen{name, e}}
+        u.records[key] = r
+        u.order = append(u.order, key)
+    }
+    r.count++
+    r.last = Seen{name, e}
+}
+
+// position to tell where a record was seen; timestamp is added if known
+func (s Seen) String() string {
+    pos := fmt.Sprintf("%s:%d", s.name, s.e.line)
+    if !s.e.ts.IsZero() {
+        pos += " (" + s.e.ts.Format(time.RFC3339Nano) + ")"
+    }
+    return pos
+}
+
+type jsonSeen struct {
+    File   string     `json:"file"`
+    Record int        `json:"record"`
+    Line   int        `json:"line"`
+    Offset int64      `json:"offset"`
+    Time   *time.Time `json:"time,omitempty"`
+}
+
+func (s Seen) json() jsonSeen {
+    j := jsonSeen{File: s.name, Record: s.e.num, Line: s.e.line, Offset: s.e.offset}
+    if !s.e.ts.IsZero() {
+        j.Time = &s.e.ts
+    }
+    return j
+}
+
+type jsonUniq struct {
+    Count      int      `json:"count"`
+    First      jsonSeen `json:"first"`
+    Last       jsonSeen `json:"last"`
+    Normalized string   `json:"normalized"`
+    Separator  string   `json:"separator"`
+    Body       string   `json:"body"`
+}
+
+// print shows each distinct record as first seen, after a line with its
+// count and positions, or as a JSON object per record with --output=jsonl.
+func (u *Uniq) print(w *bufio.Writer) {
+    for _, key := range u.order {
+        r := u.records[key]
+        if *optOutput == "jsonl" {
+            e := r.first.e
+            b, err := json.Marshal(jsonUniq{r.count, r.first.json(), r.last.json(),
+                                            key, e.text[:e.rsLen], e.text[e.rsLen:]})
+            checkError(err)
+            w.Write(append(b, '\n'))
+            continue
+        }
+        io.WriteString(w, fmt.Sprintf("%s %d times, first %s, last %s%s",
+                                      GROUP_SEPARATOR, r.count, r.first, r.last,
+                                      recordTerminator()))
+        e := r.first.e
+        e.text = strings.TrimLeft(e.text, "\n")
+        writeEntry(w, r.first.name, e, true)
+        if !strings.HasSuffix(e.text, "\n") && !nullOutput() {
+            io.WriteString(w, "\n")
+        }
+    }
+    w.Flush()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+    "os"
+    "path/filepath"
+)
+
+//////////////////////////////////////////////////////////////////////////////
+// Recursive directory search (-R)
+//
+// Like grep(1), --include, --exclude and --exclude-dir globs are matched
+// against base names of files and directories found while walking, not
+// against the ones given on the command line.
+
+func matchAny(globs []string, name string) bool {
+    for _, g := range globs {
+        if ok, _ := filepath.Match(g, name); ok {
+            return true
+        }
+    }
+    return false
+}
+
+func includeFile(name string) bool {
+    if len(*optInclude) > 0 && !matchAny(*optInclude, name) {
+        return false
+    }
+    return !matchAny(*optExclude, name)
+}
+
+// walk calls fn for each regular file under dir, in lexical order.
+// Symbolic links are skipped unless --follow-symlinks is given; 'seen'
+// guards against directory loops through them.
+func walk(dir string, seen map[string]bool, fn func(path string)) {
+    if real, err := filepath.EvalSymlinks(dir); err == nil {
+        if seen[real] {
+            return
+        }
+        seen[real] = true
+    }
+    entries, err := os.ReadDir(dir)
+    if err != nil {
+        warn("%s", err)
+        return
+    }
+    for _, ent := range entries {
+        path := filepath.Join(dir, ent.Name())
+        mode := ent.Type()
+        if mode&os.ModeSymlink != 0 {
+            if !*optFollowSymlinks {
+                continue
+            }
+            fi, err := os.Stat(path)
+            if err != nil {
+                warn("%s", err)
+                continue
+            }
+            mode = fi.Mode()
+        }
+        switch {
+        case mode.IsDir():
+            if !matchAny(*optExcludeDir, ent.Name()) {
+                walk(path, seen, fn)
+            }
+        case mode.IsRegular():
+            if includeFile(ent.Name()) {
+                fn(path)
+            }
+        }
+    }
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+    "syscall"
+)
+
+// watchDir returns a channel which is signaled when a file is created in
+// (or moved into) dir, or nil if dir cannot be watched.
+func watchDir(dir string) <-chan struct{} {
+    fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+    if err != nil {
+        return nil
+    }
+    _, err = syscall.InotifyAddWatch(fd, dir, syscall.IN_CREATE|syscall.IN_MOVED_TO)
+    if err != nil {
+        syscall.Close(fd)
+        return nil
+    }
+    ch := make(chan struct{}, 1)
+    go func() {
+        defer syscall.Close(fd)
+        buf := make([]byte, 64 * (syscall.SizeofInotifyEvent + syscall.NAME_MAX + 1))
+        for {
+            // events themselves don't matter; the glob is evaluated again
+            n, err := syscall.Read(fd, buf)
+            if err != nil || n <= 0 {
+                return
+            }
+            select {
+            case ch <- struct{}{}:
+            default:
+            }
+        }
+    }()
+    return ch
+}
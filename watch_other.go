@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// watchDir is not supported; new files are found by polling only.
+func watchDir(dir string) <-chan struct{} {
+    return nil
+}